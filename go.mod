@@ -3,6 +3,7 @@ module github.com/karelorigin/nomad-scaleway-target
 go 1.19
 
 require (
+	github.com/armon/go-metrics v0.3.11
 	github.com/hashicorp/go-hclog v1.4.0
 	github.com/hashicorp/nomad-autoscaler v0.3.7
 	github.com/hashicorp/nomad/api v0.0.0-20220519231241-2b054e38e91a
@@ -13,7 +14,6 @@ require (
 require (
 	github.com/agext/levenshtein v1.2.3 // indirect
 	github.com/apparentlymart/go-textseg/v13 v13.0.0 // indirect
-	github.com/armon/go-metrics v0.3.11 // indirect
 	github.com/fatih/color v1.13.0 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/google/go-cmp v0.5.9 // indirect
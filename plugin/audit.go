@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// A set of audit log actions
+const (
+	AuditOrphanFound      = "orphan_found"
+	AuditOrphanTerminated = "orphan_terminated"
+	AuditOrphanFailed     = "orphan_termination_failed"
+)
+
+// AuditEntry represents a single decision written to the audit log
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	ServerID string    `json:"server_id"`
+	Name     string    `json:"name,omitempty"`
+	Zone     string    `json:"zone,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// AuditLog records decisions as JSON lines, or to the plugin logger if no file is configured
+type AuditLog struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	logger hclog.Logger
+}
+
+// NewAuditLog returns a new audit log appending to the file at `path`, an empty path logs to the given logger
+func NewAuditLog(path string, logger hclog.Logger) (*AuditLog, error) {
+	a := &AuditLog{logger: logger.Named("audit")}
+
+	if len(path) == 0 {
+		return a, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	a.w = f
+
+	return a, nil
+}
+
+// Record writes the entry to the audit log, the time is set if missing
+func (a *AuditLog) Record(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.w == nil {
+		a.logger.Info(entry.Action, "server_id", entry.ServerID, "name", entry.Name, "zone", entry.Zone,
+			"reason", entry.Reason, "error", entry.Error)
+		return
+	}
+
+	b, err := json.Marshal(entry)
+	if err == nil {
+		_, err = a.w.Write(append(b, '\n'))
+	}
+
+	if err != nil {
+		a.logger.Error("Could not write audit log entry", "action", entry.Action, "server_id", entry.ServerID, "error", err)
+	}
+}
+
+// Close closes the audit log file, if any
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.w == nil {
+		return nil
+	}
+
+	return a.w.Close()
+}
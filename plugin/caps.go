@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/mitchellh/mapstructure"
+)
+
+// A set of status meta keys of the last clamped scaling action
+const (
+	MetaClampRequested = "scaleway_clamp_requested"
+	MetaClampCount     = "scaleway_clamp_count"
+	MetaClampTime      = "scaleway_clamp_time"
+)
+
+// Caps represents the hard bounds of the pool size enforced by the target, zero values are unset
+type Caps struct {
+	MinServers int64 `mapstructure:"min_servers"`
+	MaxServers int64 `mapstructure:"max_servers"`
+}
+
+// Decode decodes the cap keys from a map of strings
+func (c *Caps) Decode(config map[string]string) error {
+	var r Caps
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{WeaklyTypedInput: true, Result: &r})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	if r.MinServers < 0 || r.MaxServers < 0 {
+		return fmt.Errorf("min_servers and max_servers cannot be negative, got %d and %d", r.MinServers, r.MaxServers)
+	}
+
+	if r.MaxServers > 0 && r.MinServers > r.MaxServers {
+		return fmt.Errorf("min_servers cannot be greater than max_servers, got %d and %d", r.MinServers, r.MaxServers)
+	}
+
+	*c = r
+
+	return nil
+}
+
+// Clamp returns the count bounded by the caps and whether it had to be changed
+func (c Caps) Clamp(count int64) (int64, bool) {
+	switch {
+	case count < c.MinServers:
+		return c.MinServers, true
+	case c.MaxServers > 0 && count > c.MaxServers:
+		return c.MaxServers, true
+	}
+
+	return count, false
+}
+
+// Clamp represents a scaling action whose count was changed to stay within the caps
+type Clamp struct {
+	Requested int64
+	Count     int64
+	Time      time.Time
+}
+
+// Meta returns the clamp as status meta keys
+func (c Clamp) Meta() map[string]string {
+	return map[string]string{
+		MetaClampRequested: strconv.FormatInt(c.Requested, 10),
+		MetaClampCount:     strconv.FormatInt(c.Count, 10),
+		MetaClampTime:      c.Time.UTC().Format(time.RFC3339),
+	}
+}
+
+// clamp bounds the count of the action by the caps of the policy, clamped actions are logged and recorded
+// until the next action on the pool that is within the caps
+func (p *Plugin) clamp(policy *Policy, action *sdk.ScalingAction) bool {
+	count, clamped := policy.Caps.Clamp(action.Count)
+	if !clamped {
+		p.clamps.Delete(policy.Key())
+		return false
+	}
+
+	p.logger.Warn("Clamping scaling action to the server caps", "requested", action.Count, "count", count,
+		"min_servers", policy.Caps.MinServers, "max_servers", policy.Caps.MaxServers)
+
+	p.clamps.Store(policy.Key(), Clamp{Requested: action.Count, Count: count, Time: time.Now()})
+
+	action.Count = count
+
+	return true
+}
+
+// direction returns the direction in which the pool of `current` servers has to be scaled to reach `count` servers
+func direction(current, count int64) sdk.ScaleDirection {
+	switch {
+	case count > current:
+		return sdk.ScaleDirectionUp
+	case count < current:
+		return sdk.ScaleDirectionDown
+	}
+
+	return sdk.ScaleDirectionNone
+}
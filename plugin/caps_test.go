@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+)
+
+// TestCaps tests decoding caps and clamping counts
+func TestCaps(t *testing.T) {
+	var caps Caps
+	if err := caps.Decode(map[string]string{"min_servers": "2", "max_servers": "5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for count, expected := range map[int64]int64{0: 2, 3: 3, 9: 5} {
+		if n, clamped := caps.Clamp(count); n != expected || clamped != (count != expected) {
+			t.Errorf("Expected %d to be clamped to %d, got %d (%t)", count, expected, n, clamped)
+		}
+	}
+
+	if n, clamped := (Caps{}).Clamp(100); n != 100 || clamped {
+		t.Errorf("Expected unset caps not to clamp, got %d (%t)", n, clamped)
+	}
+
+	if err := caps.Decode(map[string]string{"min_servers": "6", "max_servers": "5"}); err == nil {
+		t.Error("Expected a minimum above the maximum to fail decoding")
+	}
+}
+
+// TestScaleCaps tests that scaling actions are clamped to the caps and that clamps are reported in the status
+func TestScaleCaps(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+	h.AddClient("client-1")
+
+	h.Policy["min_servers"] = "2"
+	h.Policy["max_servers"] = "3"
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 10, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 3 {
+		t.Errorf("Expected the scale up to be clamped to 3 servers, got %d", n)
+	}
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Meta[MetaClampRequested] != "10" || status.Meta[MetaClampCount] != "3" || status.Meta[MetaClampTime] == "" {
+		t.Errorf("Expected the clamp to be reported, got %v", status.Meta)
+	}
+
+	// Scaling to zero is clamped to the minimum
+	err = h.Plugin.Scale(sdk.ScalingAction{Count: 0, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 2 {
+		t.Errorf("Expected the scale down to be clamped to 2 servers, got %d", n)
+	}
+
+	// Actions within the caps clear the clamp
+	err = h.Plugin.Scale(sdk.ScalingAction{Count: 2, Direction: sdk.ScaleDirectionNone}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := status.Meta[MetaClampCount]; ok {
+		t.Errorf("Expected the clamp to be cleared, got %v", status.Meta)
+	}
+}
@@ -0,0 +1,173 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/armon/go-metrics"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+)
+
+// AnyZone is the pricing table zone whose price applies to the zones without a price of their own
+const AnyZone = "*"
+
+// MetaHourlyCost is the status meta key of the projected hourly cost of the pool
+const MetaHourlyCost = "scaleway_hourly_cost"
+
+// Pricing represents the hourly prices of commercial types by zone, e.g. `{"DEV1-S": {"*": 0.01, "fr-par-1": 0.0088}}`
+type Pricing map[string]map[string]float64
+
+// LoadPricing reads a JSON pricing table from the given file
+func LoadPricing(path string) (Pricing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Pricing
+
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode pricing table %s: %w", path, err)
+	}
+
+	for commercialType, zones := range p {
+		for zone, price := range zones {
+			if price < 0 {
+				return nil, fmt.Errorf("price of %s in %s cannot be negative, got %f", commercialType, zone, price)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Price returns the hourly price of the commercial type in the given zone, and whether it is known
+func (p Pricing) Price(commercialType string, zone scw.Zone) (float64, bool) {
+	zones, ok := p[commercialType]
+	if !ok {
+		return 0, false
+	}
+
+	if price, ok := zones[string(zone)]; ok {
+		return price, true
+	}
+
+	price, ok := zones[AnyZone]
+
+	return price, ok
+}
+
+// Cost returns the hourly cost of the servers, servers with an unknown price are returned separately
+func (p Pricing) Cost(servers instance.Servers) (cost float64, unknown instance.Servers) {
+	for _, server := range servers {
+		price, ok := p.Price(server.CommercialType, server.Zone)
+		if !ok {
+			unknown = append(unknown, server)
+			continue
+		}
+
+		cost += price
+	}
+
+	return cost, unknown
+}
+
+// placementPrice returns the hourly price of the server started or created for the placement. The most expensive
+// of the commercial types is used, any of them can end up being created.
+func (p Pricing) placementPrice(policy *Policy, pl placement) (price float64, ok bool) {
+	if pl.stopped != nil {
+		return p.Price(pl.stopped.CommercialType, pl.stopped.Zone)
+	}
+
+	types := pl.types
+	if len(types) == 0 {
+		types = instance.CommercialTypes{policy.Blueprint.CommercialType}
+	}
+
+	for _, t := range types {
+		typePrice, ok := p.Price(t, pl.zone)
+		if !ok {
+			return 0, false
+		}
+
+		price = math.Max(price, typePrice)
+	}
+
+	return price, true
+}
+
+// budget trims the placements that would take the hourly cost of the pool of `servers` above the maximum hourly cost
+// of the policy, placements are kept in order. An error is returned if none of them fit.
+func (p *Plugin) budget(policy *Policy, servers instance.Servers, placements []placement) ([]placement, error) {
+	max := policy.Limits.MaxHourlyCost
+	if max <= 0 || len(placements) == 0 {
+		return placements, nil
+	}
+
+	if p.pricing == nil {
+		return nil, fmt.Errorf("max_hourly_cost requires a pricing_file")
+	}
+
+	current, unknown := p.pricing.Cost(servers)
+	if len(unknown) > 0 {
+		p.logger.Warn("Could not find the price of servers, they are not part of the projected cost", "ids", unknown.IDs())
+	}
+
+	var (
+		fit       = len(placements)
+		allowed   = current
+		projected = current
+	)
+
+	// Placements without a known price never fit, they could exceed the budget
+	for i, pl := range placements {
+		price, ok := p.pricing.placementPrice(policy, pl)
+		if !ok {
+			price = math.Inf(1)
+		}
+
+		projected += price
+
+		if fit == len(placements) && allowed+price > max {
+			fit = i
+		}
+
+		if fit == len(placements) {
+			allowed += price
+		}
+	}
+
+	if fit == len(placements) {
+		return placements, nil
+	}
+
+	if fit == 0 {
+		return nil, fmt.Errorf("scaling up by %d servers would take the hourly cost from %.4f to %.4f, above the maximum of %.4f",
+			len(placements), current, projected, max)
+	}
+
+	p.logger.Warn("Trimming scale up to stay within the maximum hourly cost", "requested", len(placements),
+		"allowed", fit, "current_cost", current, "projected_cost", projected, "allowed_cost", allowed,
+		"max_hourly_cost", max)
+
+	return placements[:fit], nil
+}
+
+// poolCost returns the projected hourly cost of the pool formatted for the status meta, and records it
+func (p *Plugin) poolCost(policy *Policy, servers instance.Servers) string {
+	cost, unknown := p.pricing.Cost(servers)
+	if len(unknown) > 0 {
+		p.logger.Warn("Could not find the price of servers, they are not part of the projected cost", "ids", unknown.IDs())
+	}
+
+	metrics.SetGaugeWithLabels([]string{"scaleway", "pool", "hourly_cost"}, float32(cost),
+		[]metrics.Label{{Name: "pool", Value: policy.Key()}})
+
+	return strconv.FormatFloat(cost, 'f', 4, 64)
+}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+)
+
+// TestLoadPricing tests loading a pricing table and looking up prices
+func TestLoadPricing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+
+	err := os.WriteFile(path, []byte(`{"DEV1-S": {"*": 0.01, "fr-par-1": 0.02}, "GPU-3070-S": {"fr-par-2": 1}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pricing, err := LoadPricing(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if price, ok := pricing.Price("DEV1-S", "fr-par-1"); !ok || price != 0.02 {
+		t.Errorf("Expected the zone price, got %f (%t)", price, ok)
+	}
+
+	if price, ok := pricing.Price("DEV1-S", "nl-ams-1"); !ok || price != 0.01 {
+		t.Errorf("Expected the price of any zone, got %f (%t)", price, ok)
+	}
+
+	if _, ok := pricing.Price("GPU-3070-S", "nl-ams-1"); ok {
+		t.Error("Expected an unknown price")
+	}
+
+	err = os.WriteFile(path, []byte(`{"DEV1-S": {"*": -1}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadPricing(path); err == nil {
+		t.Error("Expected negative prices to fail loading")
+	}
+}
+
+// TestScaleUpCostGuard tests that scale ups are trimmed or refused above the maximum hourly cost
+func TestScaleUpCostGuard(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	h.Plugin.pricing = Pricing{"DEV1-S": {AnyZone: 1}}
+	h.Policy["max_hourly_cost"] = "3.5"
+
+	// Only 2 of the 4 new servers fit the budget
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 5, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 3 {
+		t.Errorf("Expected 3 servers within the budget, got %d", n)
+	}
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Meta[MetaHourlyCost] != "3.0000" {
+		t.Errorf("Expected a projected cost of 3, got %v", status.Meta)
+	}
+
+	// None of the new servers fit the budget anymore
+	err = h.Plugin.Scale(sdk.ScalingAction{Count: 5, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err == nil {
+		t.Error("Expected the scale up to be refused")
+	}
+
+	// Unknown prices never fit
+	h.Policy["max_hourly_cost"] = "100"
+	h.Policy["commercial_type"] = "GPU-3070-S"
+
+	err = h.Plugin.Scale(sdk.ScalingAction{Count: 1, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err == nil {
+		t.Error("Expected the scale up of a server without a price to be refused")
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 3 {
+		t.Errorf("Expected no new servers, got %d", n)
+	}
+}
+
+// TestSetConfigPricing tests that the plugin maximum hourly cost requires a pricing table
+func TestSetConfigPricing(t *testing.T) {
+	h := NewHarness(t)
+
+	err := h.Plugin.SetConfig(map[string]string{
+		"access_key":      instancetest.AccessKey,
+		"secret_key":      instancetest.SecretKey,
+		"nomad_address":   h.Nomad.URL,
+		"max_hourly_cost": "10",
+	})
+	if err == nil {
+		t.Error("Expected an error without a pricing table")
+	}
+}
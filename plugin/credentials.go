@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/credentials"
+)
+
+// SecretKeys holds the plugin configuration keys whose values are never logged
+var SecretKeys = []string{"secret_key", "nomad_token", "nomad_http-auth"}
+
+// Redact returns a copy of the configuration with the values of the secret keys redacted
+func Redact(config map[string]string) map[string]string {
+	r := make(map[string]string, len(config))
+	for key, value := range config {
+		r[key] = value
+	}
+
+	for _, key := range SecretKeys {
+		if len(r[key]) > 0 {
+			r[key] = credentials.Redacted
+		}
+	}
+
+	return r
+}
+
+// CredentialsWatcher periodically reads the credentials of a provider and rotates them when they change
+type CredentialsWatcher struct {
+	provider credentials.Provider
+	interval time.Duration
+	logger   hclog.Logger
+	current  credentials.Credentials
+	rotate   func(credentials.Credentials) error
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// NewCredentialsWatcher returns a new watcher of the provider starting from the current credentials, call Start to
+// check them periodically. Changed credentials are passed to `rotate`, they are retried on the next check if it fails.
+func NewCredentialsWatcher(provider credentials.Provider, interval time.Duration, current credentials.Credentials, logger hclog.Logger, rotate func(credentials.Credentials) error) *CredentialsWatcher {
+	return &CredentialsWatcher{
+		provider: provider,
+		interval: interval,
+		logger:   logger.Named("credentials"),
+		current:  current,
+		rotate:   rotate,
+	}
+}
+
+// Start checks the credentials in the background every interval until stopped, a zero interval does nothing
+func (w *CredentialsWatcher) Start() {
+	if w.interval <= 0 {
+		return
+	}
+
+	w.stop = make(chan struct{})
+	w.done.Add(1)
+
+	go func() {
+		defer w.done.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := w.Check(); err != nil {
+				w.logger.Error("Could not rotate Scaleway credentials, the current credentials are kept", "error", err)
+			}
+		}
+	}()
+}
+
+// Stop stops the background checks and waits for a running check to finish
+func (w *CredentialsWatcher) Stop() {
+	if w.stop == nil {
+		return
+	}
+
+	close(w.stop)
+	w.done.Wait()
+	w.stop = nil
+}
+
+// Check reads the credentials of the provider and rotates them if they changed, it returns whether they were rotated.
+// Checks must not run concurrently.
+func (w *CredentialsWatcher) Check() (bool, error) {
+	next, err := w.provider.Credentials()
+	if err != nil {
+		return false, err
+	}
+
+	if next == w.current {
+		return false, nil
+	}
+
+	err = w.rotate(next)
+	if err != nil {
+		return false, err
+	}
+
+	w.logger.Info("Rotated Scaleway credentials", "previous_access_key", w.current.AccessKey,
+		"access_key", next.AccessKey)
+
+	w.current = next
+
+	return true, nil
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/credentials"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+)
+
+// writeCredentials writes a credentials file with the given secret key
+func writeCredentials(t *testing.T, path, secretKey string) {
+	data := `{"access_key": "` + instancetest.AccessKey + `", "secret_key": "` + secretKey + `", "project_id": "` +
+		instancetest.ProjectID + `"}`
+
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRedact tests that the values of secret keys are redacted
+func TestRedact(t *testing.T) {
+	config := map[string]string{"access_key": "SCWXXXXXXXXXXXXXXXXX", "secret_key": "secret", "nomad_token": "token"}
+
+	r := Redact(config)
+
+	if r["secret_key"] != credentials.Redacted || r["nomad_token"] != credentials.Redacted {
+		t.Errorf("Expected the secret values to be redacted, got %v", r)
+	}
+
+	if r["access_key"] != "SCWXXXXXXXXXXXXXXXXX" {
+		t.Errorf("Expected the access key to be kept, got %s", r["access_key"])
+	}
+
+	if config["secret_key"] != "secret" {
+		t.Error("Expected the configuration not to be modified")
+	}
+}
+
+// TestSetConfigRedacted tests that the secret key is not logged
+func TestSetConfigRedacted(t *testing.T) {
+	h := NewHarness(t)
+
+	var buf bytes.Buffer
+	h.Plugin.logger = hclog.New(&hclog.LoggerOptions{Level: hclog.Trace, Output: &buf})
+
+	err := h.Plugin.SetConfig(map[string]string{
+		"access_key":    instancetest.AccessKey,
+		"secret_key":    instancetest.SecretKey,
+		"nomad_address": h.Nomad.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "Setting config") {
+		t.Fatalf("Expected the configuration to be logged, got %s", buf.String())
+	}
+
+	if strings.Contains(buf.String(), instancetest.SecretKey) {
+		t.Errorf("Expected the secret key to be redacted, got %s", buf.String())
+	}
+}
+
+// TestCredentialsRotation tests that the Scaleway clients are rebuilt when the credentials file changes
+func TestCredentialsRotation(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	writeCredentials(t, path, "33333333-3333-3333-3333-333333333333")
+
+	err := h.Plugin.SetConfig(map[string]string{
+		"nomad_address":                h.Nomad.URL,
+		"credentials_provider":         credentials.ProviderFile,
+		"credentials_file":             path,
+		"credentials_refresh_interval": "1h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func() error {
+		_, err := h.Plugin.api().ListServersAll(context.Background(), instance.Server{})
+		return err
+	}
+
+	if err := list(); err == nil {
+		t.Fatal("Expected the outdated credentials to be refused")
+	}
+
+	// Unchanged credentials are not rotated
+	rotated, err := h.Plugin.watcher.Check()
+	if err != nil || rotated {
+		t.Fatalf("Expected no rotation, got %t and %v", rotated, err)
+	}
+
+	writeCredentials(t, path, instancetest.SecretKey)
+
+	rotated, err = h.Plugin.watcher.Check()
+	if err != nil || !rotated {
+		t.Fatalf("Expected the credentials to be rotated, got %t and %v", rotated, err)
+	}
+
+	if err := list(); err != nil {
+		t.Errorf("Expected the rotated credentials to be accepted, got %v", err)
+	}
+
+	// Invalid credentials are refused and the current ones kept
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.Plugin.watcher.Check(); err == nil {
+		t.Error("Expected an error for an invalid credentials file")
+	}
+
+	if err := list(); err != nil {
+		t.Errorf("Expected the current credentials to be kept, got %v", err)
+	}
+}
+
+// TestSetConfigStaticCredentials tests that static credentials are not watched
+func TestSetConfigStaticCredentials(t *testing.T) {
+	h := NewHarness(t)
+
+	if h.Plugin.watcher != nil {
+		t.Error("Expected static credentials not to be watched")
+	}
+
+	err := h.Plugin.SetConfig(map[string]string{
+		"nomad_address":        h.Nomad.URL,
+		"credentials_provider": credentials.ProviderFile,
+	})
+	if err == nil {
+		t.Error("Expected an error for the file provider without a credentials file")
+	}
+}
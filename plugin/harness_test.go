@@ -0,0 +1,277 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// TestNodeClass is the Nomad node class of the pool managed by the test harness
+const TestNodeClass = "autoscaled"
+
+// NomadAPI is a stand-in for the Nomad HTTP API, it implements the node endpoints used by the plugin
+type NomadAPI struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	index   uint64
+	nodes   map[string]*api.Node
+	drained []string
+	purged  []string
+}
+
+// NewNomadAPI starts and returns a new stand-in Nomad API, the caller should call Close when finished
+func NewNomadAPI() *NomadAPI {
+	n := &NomadAPI{
+		nodes: make(map[string]*api.Node),
+	}
+
+	n.Server = httptest.NewServer(http.HandlerFunc(n.handle))
+
+	return n
+}
+
+// AddNode registers a ready node with the given hostname in the test pool
+func (n *NomadAPI) AddNode(hostname string) *api.Node {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.index++
+
+	node := &api.Node{
+		ID:                    fmt.Sprintf("node-%d", n.index),
+		Name:                  hostname,
+		Datacenter:            "dc1",
+		NodeClass:             TestNodeClass,
+		Status:                api.NodeStatusReady,
+		SchedulingEligibility: api.NodeSchedulingEligible,
+		Attributes:            map[string]string{"unique.hostname": hostname},
+		NodeResources: &api.NodeResources{
+			Cpu:    api.NodeCpuResources{CpuShares: 1000},
+			Memory: api.NodeMemoryResources{MemoryMB: 1024},
+		},
+		CreateIndex: n.index,
+		ModifyIndex: n.index,
+	}
+
+	n.nodes[node.ID] = node
+
+	return node
+}
+
+// Nodes returns the IDs of all the registered nodes
+func (n *NomadAPI) Nodes() (ids []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for id := range n.nodes {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Node returns the node with the given ID or nil if not found
+func (n *NomadAPI) Node(id string) *api.Node {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.nodes[id]
+}
+
+// Drained returns the IDs of all the nodes that received a drain request
+func (n *NomadAPI) Drained() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]string{}, n.drained...)
+}
+
+// Purged returns the IDs of all the nodes that have been purged
+func (n *NomadAPI) Purged() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]string{}, n.purged...)
+}
+
+// handle routes a request to the matching node endpoint
+func (n *NomadAPI) handle(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if r.URL.Path == "/v1/nodes" {
+		n.list(w)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/node/"), "/")
+
+	node, ok := n.nodes[parts[0]]
+	if !ok {
+		http.Error(w, "node not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		n.write(w, node)
+	case parts[1] == "allocations":
+		n.write(w, []*api.Allocation{})
+	case parts[1] == "drain":
+		n.drain(w, r, node)
+	case parts[1] == "eligibility":
+		var req api.NodeUpdateEligibilityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		n.index++
+		node.SchedulingEligibility = req.Eligibility
+		n.write(w, &api.NodeEligibilityUpdateResponse{NodeModifyIndex: n.index})
+	case parts[1] == "purge":
+		n.index++
+		n.purged = append(n.purged, node.ID)
+		delete(n.nodes, node.ID)
+		n.write(w, &api.NodePurgeResponse{NodeModifyIndex: n.index})
+	default:
+		http.Error(w, "unsupported endpoint", http.StatusNotFound)
+	}
+}
+
+// list writes the node list stubs
+func (n *NomadAPI) list(w http.ResponseWriter) {
+	stubs := []*api.NodeListStub{}
+
+	for _, node := range n.nodes {
+		stubs = append(stubs, &api.NodeListStub{
+			ID:                    node.ID,
+			Name:                  node.Name,
+			Attributes:            node.Attributes,
+			Datacenter:            node.Datacenter,
+			NodeClass:             node.NodeClass,
+			Drain:                 node.DrainStrategy != nil,
+			SchedulingEligibility: node.SchedulingEligibility,
+			Status:                node.Status,
+			NodeResources:         node.NodeResources,
+			CreateIndex:           node.CreateIndex,
+			ModifyIndex:           node.ModifyIndex,
+		})
+	}
+
+	sort.Sort(api.NodeIndexSort(stubs))
+
+	n.write(w, stubs)
+}
+
+// drain handles a drain request, nodes have no allocations so drains complete immediately
+func (n *NomadAPI) drain(w http.ResponseWriter, r *http.Request, node *api.Node) {
+	var req api.NodeUpdateDrainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n.index++
+	node.ModifyIndex = n.index
+
+	if req.DrainSpec != nil {
+		n.drained = append(n.drained, node.ID)
+		node.SchedulingEligibility = api.NodeSchedulingIneligible
+	}
+
+	n.write(w, &api.NodeDrainUpdateResponse{NodeModifyIndex: n.index})
+}
+
+// write writes the given value as a JSON response including the Nomad query meta headers
+func (n *NomadAPI) write(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Nomad-Index", strconv.FormatUint(n.index, 10))
+	w.Header().Set("X-Nomad-LastContact", "0")
+	w.Header().Set("X-Nomad-KnownLeader", "true")
+
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Harness runs the plugin against a stand-in Nomad API and a fake Scaleway API
+type Harness struct {
+	Plugin   *Plugin
+	Nomad    *NomadAPI
+	Scaleway *instancetest.API
+	Policy   map[string]string
+}
+
+// NewHarness returns a new harness with a configured plugin
+func NewHarness(t *testing.T) *Harness {
+	h := &Harness{
+		Plugin:   New(hclog.NewNullLogger()),
+		Nomad:    NewNomadAPI(),
+		Scaleway: instancetest.NewAPI(),
+		Policy: map[string]string{
+			"image":                  "0d1cf4a3-aae9-4294-9fd9-fefffb297615",
+			"commercial_type":        "DEV1-S",
+			"zone":                   string(instancetest.DefaultZone),
+			"user_data":              "cloud-init=#cloud-config",
+			"node_class":             TestNodeClass,
+			"node_drain_deadline":    "1m",
+			"node_purge":             "true",
+			"node_selector_strategy": "least_busy",
+		},
+	}
+
+	t.Cleanup(h.Nomad.Close)
+	t.Cleanup(h.Scaleway.Close)
+
+	t.Setenv("SCW_API_URL", h.Scaleway.URL)
+	t.Setenv("SCW_DEFAULT_ZONE", string(instancetest.DefaultZone))
+
+	err := h.Plugin.SetConfig(map[string]string{
+		"access_key":    instancetest.AccessKey,
+		"secret_key":    instancetest.SecretKey,
+		"project_id":    instancetest.ProjectID,
+		"nomad_address": h.Nomad.URL,
+
+		// Keep retries fast and requests unlimited
+		"retry_min_backoff": "1ms",
+		"retry_max_backoff": "10ms",
+		"rate_limit":        "0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+// AddClient registers a running Scaleway server and a matching Nomad node in the pool
+func (h *Harness) AddClient(hostname string) (*instance.Server, *api.Node) {
+	return h.AddZoneClient(instancetest.DefaultZone, hostname)
+}
+
+// AddZoneClient registers a running Scaleway server in the given zone and a matching Nomad node in the pool
+func (h *Harness) AddZoneClient(zone scw.Zone, hostname string) (*instance.Server, *api.Node) {
+	server := h.Scaleway.AddServer(&instance.Server{
+		Zone:           zone,
+		Name:           hostname,
+		Hostname:       hostname,
+		CommercialType: h.Policy["commercial_type"],
+		Tags:           []string{"nomad", "client", "autoscaler"},
+	})
+
+	return server, h.Nomad.AddNode(hostname)
+}
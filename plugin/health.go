@@ -0,0 +1,242 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+)
+
+// A set of transitional server modes
+const (
+	// TransitionalWait counts transitional servers and reports the target as not ready while there are any
+	TransitionalWait = "wait"
+
+	// TransitionalCount counts transitional servers without blocking scaling
+	TransitionalCount = "count"
+
+	// TransitionalIgnore neither counts transitional servers nor blocks scaling
+	TransitionalIgnore = "ignore"
+)
+
+// DefaultStuckTimeout is the default duration after which a server that is not running is considered stuck
+const DefaultStuckTimeout = time.Minute * 10
+
+// A set of status meta keys
+const (
+	MetaRunning      = "scaleway_running"
+	MetaTransitional = "scaleway_transitional"
+	MetaStuck        = "scaleway_stuck"
+	MetaStuckServers = "scaleway_stuck_servers"
+)
+
+// A set of audit log actions for stuck servers
+const (
+	AuditStuckReplaced = "stuck_replaced"
+	AuditStuckFailed   = "stuck_replacement_failed"
+)
+
+// HealthPolicy represents how the servers of a pool are classified and how stuck servers are handled
+type HealthPolicy struct {
+	Transitional   string        `mapstructure:"transitional_servers"`
+	StuckTimeout   time.Duration `mapstructure:"stuck_timeout"`
+	ReplaceTimeout time.Duration `mapstructure:"stuck_replace_timeout"`
+}
+
+// Decode decodes the health keys from a map of strings and applies defaults
+func (h *HealthPolicy) Decode(config map[string]string) error {
+	r := HealthPolicy{
+		Transitional: TransitionalWait,
+		StuckTimeout: DefaultStuckTimeout,
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result: &r})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	switch r.Transitional {
+	case TransitionalWait, TransitionalCount, TransitionalIgnore:
+	default:
+		return fmt.Errorf("invalid transitional_servers '%s', expected %s, %s or %s", r.Transitional,
+			TransitionalWait, TransitionalCount, TransitionalIgnore)
+	}
+
+	*h = r
+
+	return nil
+}
+
+// PoolHealth represents the servers of a pool grouped by their health
+type PoolHealth struct {
+	policy  *HealthPolicy
+	now     time.Time
+	classes map[instance.Health]instance.Servers
+}
+
+// Classify groups the servers of a pool by their health at the given time
+func (h *HealthPolicy) Classify(servers instance.Servers, now time.Time) *PoolHealth {
+	return &PoolHealth{policy: h, now: now, classes: servers.Classify(now, h.StuckTimeout)}
+}
+
+// Ready returns whether the pool can be scaled, stuck servers never block scaling
+func (p *PoolHealth) Ready() bool {
+	return p.policy.Transitional != TransitionalWait || len(p.classes[instance.HealthTransitional]) == 0
+}
+
+// Counted returns the servers that count towards the size of the pool
+func (p *PoolHealth) Counted() (r instance.Servers) {
+	r = append(r, p.classes[instance.HealthRunning]...)
+	r = append(r, p.classes[instance.HealthStuck]...)
+
+	if p.policy.Transitional != TransitionalIgnore {
+		r = append(r, p.classes[instance.HealthTransitional]...)
+	}
+
+	return r
+}
+
+// Stuck returns the stuck servers
+func (p *PoolHealth) Stuck() instance.Servers {
+	return p.classes[instance.HealthStuck]
+}
+
+// Replaceable returns the stuck servers that have been stuck past the replace timeout, none if replacement is disabled.
+// Protected servers are never replaced, neither are locked servers since they cannot be deleted.
+func (p *PoolHealth) Replaceable() (r instance.Servers) {
+	if p.policy.ReplaceTimeout <= 0 {
+		return nil
+	}
+
+	for _, server := range Unprotected(p.Stuck()) {
+		if server.Locked() {
+			continue
+		}
+
+		if since := server.LastModified(); since != nil && p.now.Sub(*since) > p.policy.StuckTimeout+p.policy.ReplaceTimeout {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// Meta returns the server counts by health and the IDs of the stuck servers, to be reported in the target status
+func (p *PoolHealth) Meta() map[string]string {
+	return map[string]string{
+		MetaRunning:      strconv.Itoa(len(p.classes[instance.HealthRunning])),
+		MetaTransitional: strconv.Itoa(len(p.classes[instance.HealthTransitional])),
+		MetaStuck:        strconv.Itoa(len(p.Stuck())),
+		MetaStuckServers: strings.Join(p.Stuck().IDs(), ","),
+	}
+}
+
+// Status returns the target status of the pool
+func (p *PoolHealth) Status() *sdk.TargetStatus {
+	return &sdk.TargetStatus{
+		Ready: p.Ready(),
+		Count: p.Counted().Count(),
+		Meta:  p.Meta(),
+	}
+}
+
+// replaceStuck replaces the servers of the pool that are stuck past the replace timeout in the background.
+// Replacements hold the pool like scaling actions do, at most one replacement per pool is pending at a time.
+// Failed replacements are not retried until their backoff passed.
+func (p *Plugin) replaceStuck(policy Policy) {
+	key := policy.Key()
+
+	if !p.replaceBackoff.Ready(key) {
+		return
+	}
+
+	if _, pending := p.replacing.LoadOrStore(key, true); pending {
+		return
+	}
+
+	go func() {
+		defer p.replacing.Delete(key)
+
+		release := p.states.Acquire(key)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), policy.Opt.Timeouts.ScaleTimeout())
+		defer cancel()
+
+		err := p.ReplaceStuck(ctx, &policy)
+		if err != nil {
+			p.logger.Error("Could not replace stuck servers", "error", err, "retry_in", p.replaceBackoff.Fail(key))
+			return
+		}
+
+		p.replaceBackoff.Reset(key)
+	}()
+}
+
+// ReplaceStuck deletes the servers of the pool that are stuck past the replace timeout and creates new ones instead.
+// The pool is listed again, so that servers that recovered in the meantime are kept. The servers that could not be
+// deleted are returned as an error after the others were replaced.
+func (p *Plugin) ReplaceStuck(ctx context.Context, policy *Policy) error {
+	all, err := p.api().ListServersAll(ctx, policy.Blueprint, policy.Zones...)
+	if err != nil {
+		return err
+	}
+
+	servers := policy.Pool(all)
+
+	stuck := policy.Health.Classify(servers, time.Now()).Replaceable()
+	if len(stuck) == 0 {
+		return nil
+	}
+
+	var deleted []string
+
+	results := &Results{}
+
+	for _, server := range stuck {
+		entry := AuditEntry{ServerID: server.ID, Name: server.Name, Zone: string(server.Zone),
+			Reason: fmt.Sprintf("stuck in state %s", server.State)}
+
+		p.logger.Warn("Replacing stuck server", "id", server.ID, "state", server.State, "zone", server.Zone)
+
+		err := p.api().DeleteServer(ctx, server, &policy.Opt.Timeouts, policy.Volumes.Kept()...)
+		if err != nil {
+			p.logger.Error("Could not remove stuck server", "id", server.ID, "error", err)
+
+			entry.Action, entry.Error = AuditStuckFailed, err.Error()
+			p.audit.Record(entry)
+			emitFailed(policy, server.Zone, "delete")
+			results.Add(server.ID, err)
+
+			continue
+		}
+
+		emitDeleted(policy, server.Zone, time.Time{})
+
+		entry.Action = AuditStuckReplaced
+		p.audit.Record(entry)
+
+		deleted = append(deleted, server.ID)
+	}
+
+	if len(deleted) > 0 {
+		err = p.ScaleUp(ctx, policy, servers.WithoutIDs(deleted...), policy.Resumable(all), int64(len(deleted)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return results.Err("replace")
+}
@@ -0,0 +1,174 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+)
+
+// TestStatusHealth tests that stuck servers are reported without blocking scaling
+func TestStatusHealth(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	old := time.Now().Add(-time.Hour)
+
+	stuck := h.Scaleway.AddServer(&instance.Server{Name: "client-1", State: instance.ServerStateStopped,
+		ModificationDate: &old, CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler"}})
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Ready || status.Count != 2 {
+		t.Errorf("Expected a ready pool of 2 servers, got ready=%t count=%d", status.Ready, status.Count)
+	}
+
+	if status.Meta[MetaStuck] != "1" || status.Meta[MetaStuckServers] != stuck.ID {
+		t.Errorf("Expected server %s to be reported as stuck, got %v", stuck.ID, status.Meta)
+	}
+
+	// Ignored transitional servers are neither counted nor block scaling
+	h.Scaleway.AddServer(&instance.Server{Name: "client-2", State: instance.ServerStateStarting,
+		CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler"}})
+
+	h.Policy["transitional_servers"] = TransitionalIgnore
+
+	status, err = h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Ready || status.Count != 2 || status.Meta[MetaTransitional] != "1" {
+		t.Errorf("Expected a ready pool of 2 servers and 1 transitional server, got ready=%t count=%d meta=%v",
+			status.Ready, status.Count, status.Meta)
+	}
+}
+
+// TestReplaceStuck tests that servers stuck past the replace timeout are replaced
+func TestReplaceStuck(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	var (
+		old    = time.Now().Add(-time.Hour)
+		recent = time.Now().Add(-time.Minute * 15)
+	)
+
+	stuck := h.Scaleway.AddServer(&instance.Server{Name: "client-1", State: instance.ServerStateStopped,
+		ModificationDate: &old, CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler"}})
+
+	// Stuck, but not for long enough to be replaced
+	h.Scaleway.AddServer(&instance.Server{Name: "client-2", State: instance.ServerStateStopped,
+		ModificationDate: &recent, CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler"}})
+
+	h.Policy["stuck_replace_timeout"] = "30m"
+
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	err := h.Plugin.ReplaceStuck(context.Background(), &policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Scaleway.GetServer(stuck.ID) != nil {
+		t.Error("Expected the stuck server to be deleted")
+	}
+
+	servers := h.Scaleway.Servers()
+	if len(servers) != 3 {
+		t.Fatalf("Expected 3 servers after the replacement, got %d", len(servers))
+	}
+
+	for _, server := range servers {
+		if strings.HasPrefix(server.Name, "client-") {
+			continue
+		}
+
+		if server.State != instance.ServerStateRunning {
+			t.Errorf("Expected the replacement to be running, got %s", server.State)
+		}
+	}
+}
+
+// WaitReplace waits for the pending stuck server replacement of the policy to finish
+func (h *Harness) WaitReplace(t *testing.T) {
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for _, pending := h.Plugin.replacing.Load(policy.Key()); pending; _, pending = h.Plugin.replacing.Load(policy.Key()) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the stuck server replacement")
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// TestReplaceStuckLocked tests that locked servers are reported as stuck but never replaced
+func TestReplaceStuckLocked(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	old := time.Now().Add(-time.Hour)
+
+	locked := h.Scaleway.AddServer(&instance.Server{Name: "client-1", State: instance.ServerStateLocked,
+		ModificationDate: &old, CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler"}})
+
+	h.Policy["stuck_replace_timeout"] = "30m"
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.WaitReplace(t)
+
+	if status.Meta[MetaStuckServers] != locked.ID {
+		t.Errorf("Expected server %s to be reported as stuck, got %v", locked.ID, status.Meta)
+	}
+
+	if h.Scaleway.GetServer(locked.ID) == nil || len(h.Scaleway.Servers()) != 2 {
+		t.Errorf("Expected the locked server to be kept and not replaced, got %d servers", len(h.Scaleway.Servers()))
+	}
+}
+
+// TestReplaceStuckBackoff tests that a failed replacement is not retried on every status poll
+func TestReplaceStuckBackoff(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	old := time.Now().Add(-time.Hour)
+
+	h.Scaleway.AddServer(&instance.Server{Name: "client-1", State: instance.ServerStateStopped,
+		ModificationDate: &old, CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler"}})
+
+	h.Scaleway.Inject(instancetest.Fault{Method: http.MethodDelete, Path: "servers/*",
+		Err: &instancetest.Error{Status: http.StatusConflict, Type: "conflict", Message: "boom"}})
+
+	h.Policy["stuck_replace_timeout"] = "30m"
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.Plugin.Status(h.Policy); err != nil {
+			t.Fatal(err)
+		}
+
+		h.WaitReplace(t)
+	}
+
+	if n := h.Scaleway.Requests(http.MethodDelete, "servers/*"); n != 1 {
+		t.Errorf("Expected a single attempt to delete the stuck server, got %d", n)
+	}
+}
@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+)
+
+// A set of scale in modes
+const (
+	// ScaleInDelete deletes servers together with their volumes and IPs
+	ScaleInDelete = "delete"
+
+	// ScaleInPoweroff stops servers in place, they keep their hypervisor and local volumes until resumed
+	ScaleInPoweroff = "poweroff"
+
+	// ScaleInArchive powers off servers and releases their hypervisor, resuming them takes longer
+	ScaleInArchive = "archive"
+)
+
+// HibernatedTag is the tag of the servers stopped by a scale in, they are not part of the server pool until resumed
+const HibernatedTag = "autoscaler:hibernated"
+
+// MetaHibernated is the status meta key of the number of hibernated servers
+const MetaHibernated = "scaleway_hibernated"
+
+// ScaleIn represents how servers are removed from the pool on scale in
+type ScaleIn struct {
+	Mode string `mapstructure:"scale_in_mode"`
+}
+
+// Decode decodes the scale in keys from a map of strings and applies defaults
+func (s *ScaleIn) Decode(config map[string]string) error {
+	r := ScaleIn{
+		Mode: ScaleInDelete,
+	}
+
+	err := mapstructure.Decode(config, &r)
+	if err != nil {
+		return err
+	}
+
+	switch r.Mode {
+	case ScaleInDelete, ScaleInPoweroff, ScaleInArchive:
+	default:
+		return fmt.Errorf("invalid scale_in_mode '%s', expected %s, %s or %s", r.Mode, ScaleInDelete,
+			ScaleInPoweroff, ScaleInArchive)
+	}
+
+	*s = r
+
+	return nil
+}
+
+// Hibernates returns whether servers are stopped and kept instead of being deleted
+func (s ScaleIn) Hibernates() bool {
+	return s.Mode != ScaleInDelete
+}
+
+// Hibernated filters the slice into a subslice of hibernated servers of the pool, in any of its zones
+func (p *Policy) Hibernated(servers instance.Servers) (r instance.Servers) {
+	for _, server := range p.members(servers) {
+		if server.HasTag(HibernatedTag) {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// Resumable returns the stopped servers of the pool that can be started on scale up, hibernated servers first
+// followed by warm servers. Every server is returned once.
+func (p *Policy) Resumable(servers instance.Servers) (r instance.Servers) {
+	seen := make(map[string]bool)
+
+	for _, server := range append(p.Hibernated(servers), p.Warm(servers)...) {
+		if server.Stopped() && !seen[server.ID] {
+			seen[server.ID] = true
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
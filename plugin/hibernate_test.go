@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+)
+
+// isHibernated returns whether the server has the hibernated tag
+func isHibernated(server *instance.Server) bool {
+	for _, tag := range server.Tags {
+		if tag == HibernatedTag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TestScaleInMode tests decoding the scale in mode
+func TestScaleInMode(t *testing.T) {
+	var s ScaleIn
+
+	if err := s.Decode(map[string]string{}); err != nil || s.Mode != ScaleInDelete || s.Hibernates() {
+		t.Errorf("Expected the delete mode by default, got %q (%v)", s.Mode, err)
+	}
+
+	if err := s.Decode(map[string]string{"scale_in_mode": "archive"}); err != nil || !s.Hibernates() {
+		t.Errorf("Expected the archive mode to hibernate servers, got %q (%v)", s.Mode, err)
+	}
+
+	if err := s.Decode(map[string]string{"scale_in_mode": "sleep"}); err == nil {
+		t.Error("Expected an error for an invalid mode")
+	}
+}
+
+// TestScaleDownHibernate tests that servers are stopped and kept instead of deleted when scaling in
+func TestScaleDownHibernate(t *testing.T) {
+	for mode, state := range map[string]instance.ServerState{
+		ScaleInPoweroff: instance.ServerStateStoppedInPlace,
+		ScaleInArchive:  instance.ServerStateStopped,
+	} {
+		t.Run(mode, func(t *testing.T) {
+			h := NewHarness(t)
+			h.Policy["scale_in_mode"] = mode
+
+			for _, name := range []string{"client-0", "client-1", "client-2"} {
+				h.AddClient(name)
+			}
+
+			err := h.Plugin.Scale(sdk.ScalingAction{Count: 1, Direction: sdk.ScaleDirectionDown}, h.Policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			servers := h.Scaleway.Servers()
+			if len(servers) != 3 {
+				t.Fatalf("Expected 3 servers to be kept, got %d", len(servers))
+			}
+
+			var hibernated int
+			for _, server := range servers {
+				if !isHibernated(server) {
+					continue
+				}
+
+				hibernated++
+
+				if server.State != state {
+					t.Errorf("Expected hibernated server %s to be %s, got %s", server.ID, state, server.State)
+				}
+			}
+
+			if hibernated != 2 {
+				t.Errorf("Expected 2 hibernated servers, got %d", hibernated)
+			}
+
+			status, err := h.Plugin.Status(h.Policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status.Count != 1 || status.Meta[MetaHibernated] != "2" {
+				t.Errorf("Expected 1 active server and 2 hibernated servers, got count=%d meta=%v", status.Count, status.Meta)
+			}
+		})
+	}
+}
+
+// TestScaleUpHibernated tests that hibernated servers are resumed before warm servers are started
+func TestScaleUpHibernated(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	hibernated := h.Scaleway.AddServer(&instance.Server{Name: "client-1", State: instance.ServerStateStoppedInPlace,
+		CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler", HibernatedTag}})
+
+	warm := h.AddWarm("warm-0")
+	h.Policy["warm_pool_size"] = "1"
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 2, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.WaitWarm(t)
+
+	resumed := h.Scaleway.GetServer(hibernated.ID)
+	if resumed.State != instance.ServerStateRunning || isHibernated(resumed) {
+		t.Errorf("Expected the hibernated server to be resumed, got state=%s tags=%v", resumed.State, resumed.Tags)
+	}
+
+	if state := h.Scaleway.GetServer(warm.ID).State; state != instance.ServerStateStopped {
+		t.Errorf("Expected the warm server to be kept, got %s", state)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 3 {
+		t.Errorf("Expected no new servers, got %d servers", n)
+	}
+}
+
+// TestResumableTagged tests that a stopped server with both the hibernated and the warm tag is resumable once, as a
+// hibernated server
+func TestResumableTagged(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	both := h.Scaleway.AddServer(&instance.Server{Name: "client-1", State: instance.ServerStateStopped,
+		CommercialType: h.Policy["commercial_type"],
+		Tags:           []string{"nomad", "client", "autoscaler", HibernatedTag, WarmTag}})
+
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := h.Plugin.api().ListServersAll(context.Background(), policy.Blueprint, policy.Zones...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumable := policy.Resumable(servers)
+	if len(resumable) != 1 || resumable[0].ID != both.ID {
+		t.Errorf("Expected server %s to be resumable once, got %v", both.ID, resumable.IDs())
+	}
+
+	if n := len(policy.Warm(servers)); n != 0 {
+		t.Errorf("Expected the hibernated tag to win over the warm tag, got %d warm servers", n)
+	}
+}
@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// DefaultMaxParallel is the default number of servers created or deleted in parallel
+const DefaultMaxParallel = 5
+
+// Limits represents the concurrency, step size and cost limits of scaling actions, zero values are unset
+type Limits struct {
+	MaxParallelCreates int     `mapstructure:"max_parallel_creates"`
+	MaxParallelDeletes int     `mapstructure:"max_parallel_deletes"`
+	MaxScaleStep       int     `mapstructure:"max_scale_step"`
+	MaxHourlyCost      float64 `mapstructure:"max_hourly_cost"`
+}
+
+// Decode decodes the limit keys from a map of strings
+func (l *Limits) Decode(config map[string]string) error {
+	var r Limits
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{WeaklyTypedInput: true, Result: &r})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = r.Validate()
+	if err != nil {
+		return err
+	}
+
+	*l = r
+
+	return nil
+}
+
+// Validate returns an error if any of the limits is negative
+func (l Limits) Validate() error {
+	if l.MaxParallelCreates < 0 || l.MaxParallelDeletes < 0 || l.MaxScaleStep < 0 || l.MaxHourlyCost < 0 {
+		return fmt.Errorf("limits cannot be negative, got %+v", l)
+	}
+
+	return nil
+}
+
+// Merge returns the limits with the unset values taken from `defaults`
+func (l Limits) Merge(defaults Limits) Limits {
+	if l.MaxParallelCreates == 0 {
+		l.MaxParallelCreates = defaults.MaxParallelCreates
+	}
+
+	if l.MaxParallelDeletes == 0 {
+		l.MaxParallelDeletes = defaults.MaxParallelDeletes
+	}
+
+	if l.MaxScaleStep == 0 {
+		l.MaxScaleStep = defaults.MaxScaleStep
+	}
+
+	if l.MaxHourlyCost == 0 {
+		l.MaxHourlyCost = defaults.MaxHourlyCost
+	}
+
+	return l
+}
+
+// Creates returns the number of servers to create in parallel
+func (l Limits) Creates() int {
+	return parallel(l.MaxParallelCreates)
+}
+
+// Deletes returns the number of servers to delete in parallel
+func (l Limits) Deletes() int {
+	return parallel(l.MaxParallelDeletes)
+}
+
+// Step returns the number of servers a single scaling action adds or removes out of the `n` requested
+func (l Limits) Step(n int64) int64 {
+	if l.MaxScaleStep > 0 && n > int64(l.MaxScaleStep) {
+		return int64(l.MaxScaleStep)
+	}
+
+	return n
+}
+
+// parallel returns the given parallelism or the default if it is unset
+func parallel(n int) int {
+	if n > 0 {
+		return n
+	}
+
+	return DefaultMaxParallel
+}
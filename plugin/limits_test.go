@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"testing"
+)
+
+// TestLimits tests decoding, merging and applying limits
+func TestLimits(t *testing.T) {
+	var limits Limits
+	err := limits.Decode(map[string]string{
+		"max_parallel_creates": "20",
+		"max_scale_step":       "10",
+		"max_hourly_cost":      "12.5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits = limits.Merge(Limits{MaxParallelCreates: 2, MaxParallelDeletes: 3, MaxScaleStep: 4, MaxHourlyCost: 100})
+
+	if limits.Creates() != 20 || limits.Deletes() != 3 || limits.MaxScaleStep != 10 || limits.MaxHourlyCost != 12.5 {
+		t.Errorf("Expected policy limits to take precedence over the defaults, got %+v", limits)
+	}
+
+	if n := limits.Step(70); n != 10 {
+		t.Errorf("Expected a step of 10, got %d", n)
+	}
+
+	if n := limits.Step(5); n != 5 {
+		t.Errorf("Expected a step of 5, got %d", n)
+	}
+
+	if n := (Limits{}).Creates(); n != DefaultMaxParallel {
+		t.Errorf("Expected the default parallelism, got %d", n)
+	}
+
+	if n := (Limits{}).Step(70); n != 70 {
+		t.Errorf("Expected an unlimited step, got %d", n)
+	}
+
+	err = limits.Decode(map[string]string{"max_parallel_deletes": "-1"})
+	if err == nil {
+		t.Error("Expected negative limits to fail decoding")
+	}
+}
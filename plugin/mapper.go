@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+)
+
+// A set of node mapping strategies
+const (
+	MappingMeta     = "meta"
+	MappingIP       = "ip"
+	MappingHostname = "hostname"
+)
+
+// A set of node mapping defaults
+var (
+	DefaultMappingStrategies = []string{MappingMeta, MappingIP, MappingHostname}
+	DefaultMappingMetaKey    = "scaleway_server_id"
+)
+
+// NodeMapper maps Nomad nodes to Scaleway servers by trying an ordered list of strategies
+type NodeMapper struct {
+	strategies []string
+	metaKey    string
+}
+
+// NewNodeMapper returns a new node mapper, strategies are tried in the given order
+func NewNodeMapper(strategies []string, metaKey string) (*NodeMapper, error) {
+	for _, strategy := range strategies {
+		switch strategy {
+		case MappingMeta, MappingIP, MappingHostname:
+		default:
+			return nil, fmt.Errorf("unknown node mapping strategy '%s'", strategy)
+		}
+	}
+
+	return &NodeMapper{
+		strategies: strategies,
+		metaKey:    metaKey,
+	}, nil
+}
+
+// Resolve returns the server that belongs to the given node
+func (m *NodeMapper) Resolve(node *api.Node, servers instance.Servers) (*instance.Server, error) {
+	for _, strategy := range m.strategies {
+		var (
+			server *instance.Server
+			err    error
+		)
+
+		switch strategy {
+		case MappingMeta:
+			server = m.resolveMeta(node, servers)
+		case MappingIP:
+			server, err = m.resolveIP(node, servers)
+		case MappingHostname:
+			server, err = m.resolveHostname(node, servers)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if server != nil {
+			return server, nil
+		}
+	}
+
+	return nil, fmt.Errorf("could not find a server for node %s using strategies %v", node.ID, m.strategies)
+}
+
+// resolveMeta resolves the server by the ID stored in the node meta
+func (m *NodeMapper) resolveMeta(node *api.Node, servers instance.Servers) *instance.Server {
+	id, ok := node.Meta[m.metaKey]
+	if !ok || len(id) == 0 {
+		return nil
+	}
+
+	return servers.WithID(id)
+}
+
+// resolveIP resolves the server by the IP addresses advertised by the node, ambiguous addresses are an error
+func (m *NodeMapper) resolveIP(node *api.Node, servers instance.Servers) (*instance.Server, error) {
+	var ips []string
+
+	if ip, ok := node.Attributes["unique.network.ip-address"]; ok && len(ip) > 0 {
+		ips = append(ips, ip)
+	}
+
+	if host, _, err := net.SplitHostPort(node.HTTPAddr); err == nil {
+		ips = append(ips, host)
+	}
+
+	for _, ip := range ips {
+		matches := servers.AllWithIP(ip)
+
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0], nil
+		}
+
+		return nil, fmt.Errorf("IP address '%s' of node %s matches %d servers", ip, node.ID, len(matches))
+	}
+
+	return nil, nil
+}
+
+// resolveHostname resolves the server by the node hostname, ambiguous names are an error
+func (m *NodeMapper) resolveHostname(node *api.Node, servers instance.Servers) (*instance.Server, error) {
+	name, ok := node.Attributes["unique.hostname"]
+	if !ok || len(name) == 0 {
+		return nil, nil
+	}
+
+	matches := servers.AllWithName(name)
+
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	}
+
+	return nil, fmt.Errorf("hostname '%s' of node %s matches %d servers", name, node.ID, len(matches))
+}
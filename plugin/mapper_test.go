@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"net"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+	scw "github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+)
+
+// TestNodeMapper tests resolving nodes with each of the mapping strategies
+func TestNodeMapper(t *testing.T) {
+	private, shared := "10.0.0.2", "10.0.0.5"
+	servers := instance.Servers{
+		{ID: "a", Name: "client"},
+		{ID: "b", Name: "client", PrivateIP: &private},
+		{ID: "c", Name: "client", PublicIP: &scw.ServerIP{Address: net.ParseIP("51.15.0.3")}},
+		{ID: "d", Name: "unique"},
+		{ID: "e", Name: "shared-0", PrivateIP: &shared},
+		{ID: "f", Name: "shared-1", PrivateIP: &shared},
+	}
+
+	mapper, err := NewNodeMapper(DefaultMappingStrategies, DefaultMappingMetaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		node     *api.Node
+		expected string
+	}{
+		"meta": {&api.Node{Meta: map[string]string{"scaleway_server_id": "a"},
+			Attributes: map[string]string{"unique.hostname": "client"}}, "a"},
+		"private ip": {&api.Node{Attributes: map[string]string{"unique.network.ip-address": "10.0.0.2"}}, "b"},
+		"public ip":  {&api.Node{HTTPAddr: "51.15.0.3:4646"}, "c"},
+		"hostname":   {&api.Node{Attributes: map[string]string{"unique.hostname": "unique"}}, "d"},
+		"ambiguous":  {&api.Node{Attributes: map[string]string{"unique.hostname": "client"}}, ""},
+		"unknown":    {&api.Node{Attributes: map[string]string{"unique.hostname": "unknown"}}, ""},
+		"ambiguous ip": {&api.Node{Attributes: map[string]string{"unique.network.ip-address": "10.0.0.5",
+			"unique.hostname": "shared-0"}}, ""},
+	}
+
+	for name, test := range tests {
+		server, err := mapper.Resolve(test.node, servers)
+
+		if len(test.expected) == 0 {
+			if err == nil {
+				t.Errorf("%s: expected an error, got server %s", name, server.ID)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		if server.ID != test.expected {
+			t.Errorf("%s: expected server %s, got %s", name, test.expected, server.ID)
+		}
+	}
+
+	if _, err := NewNodeMapper([]string{"mac"}, ""); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
+
+// TestClusterWith tests that scoped node lookups only resolve against the given servers
+func TestClusterWith(t *testing.T) {
+	h := NewHarness(t)
+	a, node := h.AddClient("client-0")
+	b, _ := h.AddClient("client-1")
+
+	id, err := h.Plugin.clusterWith(instance.Servers{(*instance.Server)(a)}).ClusterNodeIDLookupFunc(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != a.ID {
+		t.Errorf("Expected server ID %s, got %s", a.ID, id)
+	}
+
+	// The servers of another listing are never used
+	_, err = h.Plugin.clusterWith(instance.Servers{(*instance.Server)(b)}).ClusterNodeIDLookupFunc(node)
+	if err == nil {
+		t.Error("Expected an error for a node without a matching server in the listing")
+	}
+}
@@ -0,0 +1,167 @@
+package plugin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+)
+
+// DefaultTelemetryPrefix is the default prefix of all the metrics emitted by the plugin
+const DefaultTelemetryPrefix = "nomad-autoscaler"
+
+// TelemetryConfig represents the metric sinks of the plugin, metrics are discarded if no sink is configured
+type TelemetryConfig struct {
+	StatsdAddr   string `mapstructure:"telemetry_statsd_address"`
+	StatsiteAddr string `mapstructure:"telemetry_statsite_address"`
+	Prefix       string `mapstructure:"telemetry_prefix"`
+}
+
+// telemetry holds the telemetry configuration that was set up last and the metrics using its sinks
+var telemetry struct {
+	mu      sync.Mutex
+	conf    *TelemetryConfig
+	metrics *metrics.Metrics
+}
+
+// SetupTelemetry sets up the global metric sinks, the plugin runs in its own process and cannot use the
+// sinks of the autoscaler. The sinks are only rebuilt when the configuration changes, the sinks they replace are
+// shut down.
+func SetupTelemetry(conf TelemetryConfig) error {
+	telemetry.mu.Lock()
+	defer telemetry.mu.Unlock()
+
+	if telemetry.conf != nil && *telemetry.conf == conf {
+		return nil
+	}
+
+	var sinks metrics.FanoutSink
+
+	if len(conf.StatsdAddr) > 0 {
+		sink, err := metrics.NewStatsdSink(conf.StatsdAddr)
+		if err != nil {
+			return err
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	if len(conf.StatsiteAddr) > 0 {
+		sink, err := metrics.NewStatsiteSink(conf.StatsiteAddr)
+		if err != nil {
+			sinks.Shutdown()
+			return err
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	var sink metrics.MetricSink = sinks
+
+	// Metrics keep going to the sinks of the previous configuration unless they are discarded explicitly
+	if len(sinks) == 0 {
+		if telemetry.metrics == nil {
+			telemetry.conf = &conf
+			return nil
+		}
+
+		sink = &metrics.BlackholeSink{}
+	}
+
+	prefix := conf.Prefix
+	if len(prefix) == 0 {
+		prefix = DefaultTelemetryPrefix
+	}
+
+	config := metrics.DefaultConfig(prefix)
+	config.EnableHostname = false
+
+	m, err := metrics.NewGlobal(config, sink)
+	if err != nil {
+		sinks.Shutdown()
+		return err
+	}
+
+	if telemetry.metrics != nil {
+		telemetry.metrics.Shutdown()
+	}
+
+	telemetry.conf, telemetry.metrics = &conf, m
+
+	return nil
+}
+
+// poolLabels returns the labels identifying the pool of the policy and the zone
+func poolLabels(policy *Policy, zone scw.Zone, labels ...metrics.Label) []metrics.Label {
+	return append([]metrics.Label{{Name: "pool", Value: policy.Key()}, {Name: "zone", Value: string(zone)}}, labels...)
+}
+
+// emitCreated records a created server and the time it took to get it running
+func emitCreated(policy *Policy, zone scw.Zone, start time.Time) {
+	labels := poolLabels(policy, zone)
+
+	metrics.IncrCounterWithLabels([]string{"scaleway", "servers", "created"}, 1, labels)
+	metrics.MeasureSinceWithLabels([]string{"scaleway", "servers", "create_to_running"}, start, labels)
+}
+
+// emitStarted records a warm or hibernated server that was started and the time it took to get it running
+func emitStarted(policy *Policy, zone scw.Zone, start time.Time) {
+	labels := poolLabels(policy, zone)
+
+	metrics.IncrCounterWithLabels([]string{"scaleway", "servers", "started"}, 1, labels)
+	metrics.MeasureSinceWithLabels([]string{"scaleway", "servers", "start_to_running"}, start, labels)
+}
+
+// emitHibernated records a server stopped by a scale in and, unless zero, the time since its node started draining
+func emitHibernated(policy *Policy, zone scw.Zone, drained time.Time) {
+	labels := poolLabels(policy, zone)
+
+	metrics.IncrCounterWithLabels([]string{"scaleway", "servers", "hibernated"}, 1, labels)
+
+	if !drained.IsZero() {
+		metrics.MeasureSinceWithLabels([]string{"scaleway", "servers", "drain_to_hibernate"}, drained, labels)
+	}
+}
+
+// emitProvisioned records a warm server that was provisioned
+func emitProvisioned(policy *Policy, zone scw.Zone) {
+	metrics.IncrCounterWithLabels([]string{"scaleway", "servers", "provisioned"}, 1, poolLabels(policy, zone))
+}
+
+// emitDeleted records a deleted server and, unless zero, the time since its node started draining
+func emitDeleted(policy *Policy, zone scw.Zone, drained time.Time) {
+	labels := poolLabels(policy, zone)
+
+	metrics.IncrCounterWithLabels([]string{"scaleway", "servers", "deleted"}, 1, labels)
+
+	if !drained.IsZero() {
+		metrics.MeasureSinceWithLabels([]string{"scaleway", "servers", "drain_to_delete"}, drained, labels)
+	}
+}
+
+// emitFailed records a server that could not be created, provisioned, started, hibernated or deleted
+func emitFailed(policy *Policy, zone scw.Zone, operation string) {
+	metrics.IncrCounterWithLabels([]string{"scaleway", "servers", "failed"}, 1,
+		poolLabels(policy, zone, metrics.Label{Name: "operation", Value: operation}))
+}
+
+// emitPoolSize records the number of servers of the pool by zone and state, states without servers are reported as zero
+func emitPoolSize(policy *Policy, servers instance.Servers) {
+	for _, zone := range policy.Zones {
+		counts := make(map[string]int)
+
+		for _, server := range servers {
+			if server.Zone == zone {
+				counts[string(server.State)]++
+			}
+		}
+
+		for _, state := range instance.ServerStates {
+			metrics.SetGaugeWithLabels([]string{"scaleway", "pool", "servers"}, float32(counts[string(state)]),
+				poolLabels(policy, zone, metrics.Label{Name: "state", Value: string(state)}))
+		}
+	}
+}
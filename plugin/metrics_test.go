@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+)
+
+// NewTestSink installs and returns an in-memory metric sink for the duration of the test
+func NewTestSink(t *testing.T) *metrics.InmemSink {
+	config := metrics.DefaultConfig("test")
+	config.EnableHostname = false
+	config.EnableRuntimeMetrics = false
+
+	sink := metrics.NewInmemSink(time.Hour, time.Hour)
+
+	if _, err := metrics.NewGlobal(config, sink); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = metrics.NewGlobal(config, &metrics.BlackholeSink{})
+	})
+
+	return sink
+}
+
+// Counter returns the sum of the counters with the given name, regardless of their labels
+func Counter(sink *metrics.InmemSink, name string) (n int) {
+	for _, interval := range sink.Data() {
+		interval.RLock()
+		for key, counter := range interval.Counters {
+			if strings.HasPrefix(key, "test."+name+";") {
+				n += int(counter.Sum)
+			}
+		}
+		interval.RUnlock()
+	}
+
+	return n
+}
+
+// TestScaleMetrics tests that scaling actions emit server metrics labelled by pool and zone
+func TestScaleMetrics(t *testing.T) {
+	sink := NewTestSink(t)
+
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 3, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := Counter(sink, "scaleway.servers.created"); n != 2 {
+		t.Errorf("Expected 2 created servers, got %d", n)
+	}
+
+	err = h.Plugin.Scale(sdk.ScalingAction{Count: 2, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := Counter(sink, "scaleway.servers.deleted"); n != 1 {
+		t.Errorf("Expected 1 deleted server, got %d", n)
+	}
+
+	_, err = h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	data := sink.Data()
+	data[0].RLock()
+	defer data[0].RUnlock()
+
+	if _, ok := data[0].Samples["test.scaleway.servers.create_to_running;pool="+policy.Key()+";zone="+h.Policy["zone"]]; !ok {
+		t.Error("Expected create to running latencies labelled by pool and zone")
+	}
+
+	gauge, ok := data[0].Gauges["test.scaleway.pool.servers;pool="+policy.Key()+";zone="+h.Policy["zone"]+";state=running"]
+	if !ok || gauge.Value != 2 {
+		t.Errorf("Expected a pool size gauge of 2 running servers, got %v", gauge.Value)
+	}
+}
+
+// TestSetupTelemetry tests that the metric sinks are only rebuilt when the telemetry configuration changes
+func TestSetupTelemetry(t *testing.T) {
+	t.Cleanup(func() {
+		_ = SetupTelemetry(TelemetryConfig{})
+	})
+
+	conf := TelemetryConfig{StatsdAddr: "127.0.0.1:8125"}
+
+	err := SetupTelemetry(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := metrics.Default()
+
+	err = SetupTelemetry(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics.Default() != m {
+		t.Error("Expected the sinks to be kept for an unchanged configuration")
+	}
+
+	conf.Prefix = "test"
+
+	err = SetupTelemetry(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics.Default() == m {
+		t.Error("Expected the sinks to be rebuilt for a changed configuration")
+	}
+}
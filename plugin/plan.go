@@ -0,0 +1,257 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// dryRunCountKey is the action meta key holding the desired count of a dry-run action
+const dryRunCountKey = "nomad_autoscaler.dry_run.count"
+
+// Plan represents the changes a scaling action would make to the server pool
+type Plan struct {
+	Direction string
+	Current   int64
+	Desired   int64
+	Create    []PlannedServer
+	Delete    []PlannedDeletion
+}
+
+// PlannedServer represents a server that would be created, or the stopped server that would be started
+type PlannedServer struct {
+	Name            string
+	Zone            scw.Zone
+	CommercialTypes instance.CommercialTypes
+	StartServerID   string
+}
+
+// PlannedDeletion represents a node that would be drained and the server that would be deleted
+type PlannedDeletion struct {
+	NodeID   string
+	ServerID string
+	Zone     scw.Zone
+}
+
+// Log logs the plan, one line for the summary and one line per server
+func (p *Plan) Log(logger hclog.Logger) {
+	logger.Info("Dry-run scaling plan", "direction", p.Direction, "current", p.Current, "desired", p.Desired,
+		"create", len(p.Create), "delete", len(p.Delete))
+
+	for _, server := range p.Create {
+		if len(server.StartServerID) > 0 {
+			logger.Info("Dry-run would start stopped server", "name", server.Name, "zone", server.Zone,
+				"server_id", server.StartServerID)
+			continue
+		}
+
+		logger.Info("Dry-run would create server", "name", server.Name, "zone", server.Zone,
+			"commercial_types", server.CommercialTypes)
+	}
+
+	for _, deletion := range p.Delete {
+		logger.Info("Dry-run would drain node and delete server", "node_id", deletion.NodeID,
+			"server_id", deletion.ServerID, "zone", deletion.Zone)
+	}
+}
+
+// DryRunCount returns the desired count of a dry-run action
+func DryRunCount(action sdk.ScalingAction) (int64, error) {
+	switch v := action.Meta[dryRunCountKey].(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case nil:
+		return 0, fmt.Errorf("dry-run action is missing the %s meta key", dryRunCountKey)
+	default:
+		return 0, fmt.Errorf("unsupported dry-run count type %T", v)
+	}
+}
+
+// Plan computes the changes the given action would make to the server pool without making them
+func (p *Plugin) Plan(ctx context.Context, action sdk.ScalingAction, config map[string]string) (*Plan, error) {
+	if action.Count == sdk.StrategyActionMetaValueDryRunCount {
+		count, err := DryRunCount(action)
+		if err != nil {
+			return nil, err
+		}
+
+		action.Count = count
+	}
+
+	policy, err := p.policy(config)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := p.api().ListServersAll(ctx, policy.Blueprint, policy.Zones...)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, stopped := policy.Pool(servers), policy.Resumable(servers)
+	current := policy.Health.Classify(servers, time.Now()).Counted().Count()
+
+	// Dry-runs report the clamped count without recording the clamp
+	if count, clamped := policy.Caps.Clamp(action.Count); clamped {
+		p.logger.Info("Dry-run would clamp scaling action to the server caps", "requested", action.Count, "count", count)
+		action.Count, action.Direction = count, direction(current, count)
+	}
+
+	plan := &Plan{
+		Direction: "none",
+		Current:   current,
+		Desired:   action.Count,
+	}
+
+	switch {
+	case action.Direction == sdk.ScaleDirectionUp && action.Count > current:
+		plan.Direction = "up"
+		plan.Create, err = p.planScaleUp(ctx, &policy, servers, stopped, int(p.step(&policy, action.Count-current)))
+	case action.Direction == sdk.ScaleDirectionDown && action.Count < current:
+		plan.Direction = "down"
+		plan.Delete, err = p.planScaleDown(ctx, &policy, config, int(p.step(&policy, current-action.Count)))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// planScaleUp returns the servers that would be created or started to scale up the pool of `servers` by `num` servers
+func (p *Plugin) planScaleUp(ctx context.Context, policy *Policy, servers, stopped instance.Servers, num int) ([]PlannedServer, error) {
+	var namer *instance.Namer
+	if policy.Opt.Name.IsTemplate() {
+		namer = instance.NewNamer(policy.Opt.Name, append(append(instance.Servers{}, servers...), stopped...))
+	}
+
+	spread := policy.Zones.Spread(servers, num)
+	types := p.commercialTypes(ctx, policy, spread)
+
+	placements := make([]placement, len(spread))
+	for i, zone := range spread {
+		placements[i] = placement{index: i, zone: zone, types: types[zone]}
+	}
+
+	assignStopped(placements, stopped)
+
+	placements, err := p.budget(policy, servers, placements)
+	if err != nil {
+		return nil, err
+	}
+
+	planned := make([]PlannedServer, len(placements))
+
+	for i, pl := range placements {
+		if pl.stopped != nil {
+			planned[i] = PlannedServer{
+				Name:            pl.stopped.Name,
+				Zone:            pl.stopped.Zone,
+				CommercialTypes: instance.CommercialTypes{pl.stopped.CommercialType},
+				StartServerID:   pl.stopped.ID,
+			}
+
+			continue
+		}
+
+		planned[i] = PlannedServer{
+			Name:            policy.Blueprint.Name,
+			Zone:            pl.zone,
+			CommercialTypes: pl.types,
+		}
+
+		if len(planned[i].CommercialTypes) == 0 {
+			planned[i].CommercialTypes = instance.CommercialTypes{policy.Blueprint.CommercialType}
+		}
+
+		if namer != nil {
+			name, err := namer.Next(pl.zone)
+			if err != nil {
+				return nil, err
+			}
+
+			planned[i].Name = name
+		}
+	}
+
+	return planned, nil
+}
+
+// planScaleDown returns the nodes that would be drained and deleted to scale down the pool by `num` servers.
+// Nodes are selected like `ClusterRunPreScaleInTasks` does, but without draining them.
+func (p *Plugin) planScaleDown(ctx context.Context, policy *Policy, config map[string]string, num int) ([]PlannedDeletion, error) {
+	servers, err := p.api().ListServersAll(ctx, instance.Server{}, policy.Zones...)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := p.clusterWith(servers)
+
+	nodes, err := cluster.IdentifyScaleInNodes(config, num)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := cluster.IdentifyScaleInRemoteIDs(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := make(map[string]string, len(ids))
+	for _, id := range ids {
+		remote[id.NomadNodeID] = id.RemoteResourceID
+	}
+
+	removable, trim, short := policy.candidates(servers, num)
+
+	if short > 0 {
+		p.logger.Warn("Dry-run found protected servers stopping the scale down from reaching the target",
+			"requested", num, "protected", short)
+	}
+
+	var planned []PlannedDeletion
+
+	for _, zone := range policy.Zones {
+		if trim[zone] == 0 || len(removable[zone]) == 0 {
+			continue
+		}
+
+		var candidates []*api.NodeListStub
+		for _, node := range nodes {
+			if removable[zone].WithID(remote[node.ID]) != nil {
+				candidates = append(candidates, node)
+			}
+		}
+
+		if len(candidates) == 0 {
+			p.logger.Warn("Dry-run found no nodes to remove", "zone", zone)
+			continue
+		}
+
+		selected, err := cluster.SelectScaleInNodes(candidates, config, trim[zone])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range selected {
+			planned = append(planned, PlannedDeletion{NodeID: node.ID, ServerID: remote[node.ID], Zone: zone})
+		}
+	}
+
+	return planned, nil
+}
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// NewDryRunAction returns a new dry-run scaling action
+func NewDryRunAction(count int64, direction sdk.ScaleDirection) sdk.ScalingAction {
+	action := sdk.ScalingAction{Count: count, Direction: direction, Meta: map[string]interface{}{}}
+	action.SetDryRun()
+
+	return action
+}
+
+// TestPlanScaleUp tests planning a scale up without creating servers
+func TestPlanScaleUp(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["name"] = "client-{{zone}}-{{index}}"
+	h.Policy["zones"] = "fr-par-1,nl-ams-1"
+
+	h.AddZoneClient(scw.ZoneNlAms1, "client-nl-ams-1-0")
+
+	action := NewDryRunAction(3, sdk.ScaleDirectionUp)
+
+	plan, err := h.Plugin.Plan(context.Background(), action, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Direction != "up" || plan.Current != 1 || plan.Desired != 3 {
+		t.Errorf("Expected a scale up from 1 to 3, got %s from %d to %d", plan.Direction, plan.Current, plan.Desired)
+	}
+
+	expected := []PlannedServer{
+		{Name: "client-fr-par-1-0", Zone: scw.ZoneFrPar1},
+		{Name: "client-fr-par-1-1", Zone: scw.ZoneFrPar1},
+	}
+
+	if len(plan.Create) != len(expected) {
+		t.Fatalf("Expected %d planned servers, got %d", len(expected), len(plan.Create))
+	}
+
+	for i, server := range plan.Create {
+		if server.Name != expected[i].Name || server.Zone != expected[i].Zone {
+			t.Errorf("Expected %s in %s, got %s in %s", expected[i].Name, expected[i].Zone, server.Name, server.Zone)
+		}
+
+		if len(server.CommercialTypes) != 1 || server.CommercialTypes[0] != "DEV1-S" {
+			t.Errorf("Expected commercial type DEV1-S, got %v", server.CommercialTypes)
+		}
+	}
+
+	err = h.Plugin.Scale(action, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 1 {
+		t.Errorf("Expected the dry-run to leave 1 server, got %d", n)
+	}
+}
+
+// TestPlanScaleDown tests planning a scale down without draining nodes or deleting servers
+func TestPlanScaleDown(t *testing.T) {
+	h := NewHarness(t)
+
+	for _, name := range []string{"client-0", "client-1", "client-2"} {
+		h.AddClient(name)
+	}
+
+	action := NewDryRunAction(1, sdk.ScaleDirectionDown)
+
+	plan, err := h.Plugin.Plan(context.Background(), action, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Direction != "down" || len(plan.Delete) != 2 {
+		t.Fatalf("Expected 2 planned deletions, got %s with %d", plan.Direction, len(plan.Delete))
+	}
+
+	for _, deletion := range plan.Delete {
+		node := h.Nomad.Node(deletion.NodeID)
+		if node == nil {
+			t.Fatalf("Expected node %s to exist", deletion.NodeID)
+		}
+
+		server := h.Scaleway.GetServer(deletion.ServerID)
+		if server == nil || server.Name != node.Name {
+			t.Errorf("Expected server %s to belong to node %s", deletion.ServerID, node.Name)
+		}
+	}
+
+	err = h.Plugin.Scale(action, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Nomad.Drained()); n != 0 {
+		t.Errorf("Expected no drained nodes, got %d", n)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 3 {
+		t.Errorf("Expected 3 servers, got %d", n)
+	}
+}
@@ -2,16 +2,19 @@ package plugin
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/mapstructure"
 
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/credentials"
 	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/retry"
+	"github.com/karelorigin/nomad-scaleway-target/types"
 	"github.com/scaleway/scaleway-sdk-go/scw"
 
 	"github.com/hashicorp/nomad-autoscaler/plugins/base"
@@ -27,10 +30,41 @@ var _ target.Target = (*Plugin)(nil)
 
 // Plugin represents the Scaleway target plugin
 type Plugin struct {
-	State
-	logger   hclog.Logger
+	states    States
+	logger    hclog.Logger
+	cluster   *scaleutils.ClusterScaleUtils
+	mapper    *NodeMapper
+	limits    Limits
+	pricing   Pricing
+	audit     *AuditLog
+	reaper    *Reaper
+	watcher   *CredentialsWatcher
+	transport *retry.Transport
+	imageTTL  time.Duration
+
+	// mu guards the Scaleway API clients, they are rebuilt when the credentials are rotated
+	mu       sync.RWMutex
 	instance *instance.API
-	cluster  *scaleutils.ClusterScaleUtils
+	images   *instance.Images
+	zone     scw.Zone
+
+	// replacing holds the keys of the pools with a pending stuck server replacement
+	replacing sync.Map
+
+	// replaceBackoff delays the stuck server replacements of the pools whose last replacement failed
+	replaceBackoff Backoff
+
+	// warming holds the keys of the pools with a pending warm pool refill
+	warming sync.Map
+
+	// warmBackoff delays the warm pool refills of the pools whose last refill failed
+	warmBackoff Backoff
+
+	// clamps holds the last clamped scaling action of each pool by key
+	clamps sync.Map
+
+	// policies holds the last policy of each pool by key, node lookups outside of scaling actions span their servers
+	policies sync.Map
 }
 
 // Config represents a plugin configuration object
@@ -41,6 +75,59 @@ type Config struct {
 	ProjectID string `mapstructure:"project_id"`
 	Region    string `mapstructure:"region"`
 	Zone      string `mapstructure:"zone"`
+
+	NodeMapping        types.SliceString `mapstructure:"node_mapping"`
+	NodeMappingMetaKey string            `mapstructure:"node_mapping_meta_key"`
+	PricingFile        string            `mapstructure:"pricing_file"`
+	ImageCacheTTL      time.Duration     `mapstructure:"image_cache_ttl"`
+
+	Credentials credentials.Config `mapstructure:",squash"`
+	Retry       retry.Config       `mapstructure:",squash"`
+	Limits      Limits             `mapstructure:",squash"`
+	Reaper      ReaperConfig       `mapstructure:",squash"`
+	Telemetry   TelemetryConfig    `mapstructure:",squash"`
+}
+
+// Decode decodes a map of strings into a configuration object and applies defaults
+func (c *Config) Decode(config map[string]string) error {
+	c.Credentials = credentials.DefaultConfig()
+	c.Retry = retry.DefaultConfig()
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: mapstructure.ComposeDecodeHookFunc(
+		mapstructure.TextUnmarshallerHookFunc(), mapstructure.StringToTimeDurationHookFunc()),
+		WeaklyTypedInput: true, Result: c})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	if len(c.NodeMapping) == 0 {
+		c.NodeMapping = DefaultMappingStrategies
+	}
+
+	if len(c.NodeMappingMetaKey) == 0 {
+		c.NodeMappingMetaKey = DefaultMappingMetaKey
+	}
+
+	if c.ImageCacheTTL < 0 {
+		return fmt.Errorf("image_cache_ttl cannot be negative, got %s", c.ImageCacheTTL)
+	}
+
+	err = c.Credentials.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = c.Reaper.Validate()
+	if err != nil {
+		return err
+	}
+
+	return c.Limits.Validate()
 }
 
 // New returns a new Scaleway target plugin instance
@@ -60,21 +147,64 @@ func (p *Plugin) PluginInfo() (*base.PluginInfo, error) {
 
 // SetConfig sets the plugin configuration, usually called by the Nomad autoscaler
 func (p *Plugin) SetConfig(config map[string]string) error {
-	p.logger.Debug("Seting config", "config", config)
+	p.logger.Debug("Setting config", "config", Redact(config))
 
 	var conf Config
-	err := mapstructure.Decode(config, &conf)
+	err := conf.Decode(config)
 	if err != nil {
 		return err
 	}
 
-	client, err := scw.NewClient(scw.WithAuth(conf.AccessKey, conf.SecretKey),
-		scw.WithDefaultProjectID(conf.ProjectID), scw.WithEnv())
+	p.mapper, err = NewNodeMapper(conf.NodeMapping, conf.NodeMappingMetaKey)
 	if err != nil {
 		return err
 	}
 
-	p.instance = instance.NewAPI(client)
+	p.limits = conf.Limits
+
+	// The cost guard of policies without a pricing table refuses to scale up
+	p.pricing = nil
+	if len(conf.PricingFile) > 0 {
+		p.pricing, err = LoadPricing(conf.PricingFile)
+		if err != nil {
+			return err
+		}
+	} else if conf.Limits.MaxHourlyCost > 0 {
+		return fmt.Errorf("max_hourly_cost requires a pricing_file")
+	}
+
+	err = SetupTelemetry(conf.Telemetry)
+	if err != nil {
+		return err
+	}
+
+	provider, err := credentials.NewProvider(conf.Credentials, credentials.Credentials{AccessKey: conf.AccessKey,
+		SecretKey: conf.SecretKey, ProjectID: conf.ProjectID, OrganizationID: conf.OrgID})
+	if err != nil {
+		return err
+	}
+
+	creds, err := provider.Credentials()
+	if err != nil {
+		return fmt.Errorf("could not read Scaleway credentials: %w", err)
+	}
+
+	// A running watcher must not replace the clients built from the new configuration
+	if p.watcher != nil {
+		p.watcher.Stop()
+		p.watcher = nil
+	}
+
+	// Requests of all the workers share a single rate limiter, idempotent requests are retried on transient errors
+	p.transport = retry.NewTransport(nil, conf.Retry)
+	p.imageTTL = conf.ImageCacheTTL
+
+	err = p.connect(creds)
+	if err != nil {
+		return err
+	}
+
+	p.startWatcher(conf, provider, creds)
 
 	p.cluster, err = scaleutils.NewClusterScaleUtils(nomad.ConfigFromNamespacedMap(config), p.logger)
 	if err != nil {
@@ -83,48 +213,133 @@ func (p *Plugin) SetConfig(config map[string]string) error {
 
 	p.cluster.ClusterNodeIDLookupFunc = p.LookupNodeID
 
+	return p.startReaper(conf, config)
+}
+
+// connect builds the Scaleway API clients using the given credentials, the clients in use are replaced. Requests of
+// all the clients share the transport of the plugin.
+func (p *Plugin) connect(creds credentials.Credentials) error {
+	// The credentials take precedence over the environment, other settings like the API URL are left to it
+	client, err := scw.NewClient(append([]scw.ClientOption{scw.WithHTTPClient(p.transport.Client()), scw.WithEnv()},
+		creds.ClientOptions()...)...)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.instance = instance.NewAPI(client)
+	p.images = instance.NewImages(client, p.imageTTL)
+	p.zone, _ = client.GetDefaultZone()
+
 	return nil
 }
 
-// Scale performs a scaling action against the target
-func (p *Plugin) Scale(action sdk.ScalingAction, config map[string]string) error {
-	p.logger.Debug("Received scale action", "count", action.Count, "reason", action.Reason)
+// api returns the Scaleway Instance API client in use
+func (p *Plugin) api() *instance.API {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	p.SetActive()
-	defer p.SetIdle()
+	return p.instance
+}
 
-	// Dry-runs are not supported by Scaleway
-	if action.Count == sdk.StrategyActionMetaValueDryRunCount {
-		return nil
+// startWatcher starts a credentials watcher checking the provider, if its credentials can change
+func (p *Plugin) startWatcher(conf Config, provider credentials.Provider, current credentials.Credentials) {
+	if !conf.Credentials.Rotates() {
+		return
+	}
+
+	p.watcher = NewCredentialsWatcher(provider, conf.Credentials.RefreshInterval, current, p.logger, p.connect)
+	p.watcher.Start()
+}
+
+// startReaper replaces the orphaned server reaper and the audit log with ones using the given configuration
+func (p *Plugin) startReaper(conf Config, config map[string]string) error {
+	if p.reaper != nil {
+		p.reaper.Stop()
+	}
+
+	if p.audit != nil {
+		if err := p.audit.Close(); err != nil {
+			p.logger.Warn("Could not close audit log", "error", err)
+		}
 	}
 
-	var blueprint instance.Server
-	err := blueprint.Decode(config)
+	var err error
+
+	p.audit, err = NewAuditLog(conf.Reaper.AuditLog, p.logger)
 	if err != nil {
 		return err
 	}
 
-	var opt instance.ServerOpt
-	err = opt.Decode(config)
+	client, err := api.NewClient(nomad.ConfigFromNamespacedMap(config))
 	if err != nil {
 		return err
 	}
 
-	servers, err := p.instance.ListServersAll(blueprint)
+	p.reaper = NewReaper(conf.Reaper, p.logger, p.api, p.poolZones, client, p.mapper, p.audit)
+	p.reaper.Start()
+
+	return nil
+}
+
+// Scale performs a scaling action against the target
+func (p *Plugin) Scale(action sdk.ScalingAction, config map[string]string) error {
+	p.logger.Debug("Received scale action", "count", action.Count, "reason", action.Reason)
+
+	policy, err := p.policy(config)
 	if err != nil {
 		return err
 	}
 
-	p.logger.Debug("Scaling", "direction", action.Direction, "current servers", servers.Count())
+	// Scaling actions on the same pool are serialized, other pools are not affected
+	release := p.states.Acquire(policy.Key())
+	defer release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	// The whole action, including the drain of nodes, is bound by the scale timeout of the policy
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Opt.Timeouts.ScaleTimeout())
 	defer cancel()
 
+	// Dry-runs compute and report the plan without making any changes
+	if action.Count == sdk.StrategyActionMetaValueDryRunCount {
+		plan, err := p.Plan(ctx, action, config)
+		if err != nil {
+			return err
+		}
+
+		plan.Log(p.logger)
+
+		return nil
+	}
+
+	servers, err := p.api().ListServersAll(ctx, policy.Blueprint, policy.Zones...)
+	if err != nil {
+		return err
+	}
+
+	pool, warm, stopped := policy.Pool(servers), policy.Warm(servers), policy.Resumable(servers)
+
+	// The current size is counted like `Status` reports it
+	current := policy.Health.Classify(pool, time.Now()).Counted().Count()
+
+	// The caps are enforced no matter what the autoscaler asks for, clamped counts can change the direction
+	if p.clamp(&policy, &action) {
+		action.Direction = direction(current, action.Count)
+	}
+
+	p.logger.Debug("Scaling", "direction", action.Direction, "current servers", current, "stopped servers", len(stopped))
+
+	// The warm pool is refilled once the scaling action released the pool
+	if policy.WarmPool.Size > 0 || len(warm) > 0 {
+		defer p.refillWarm(policy)
+	}
+
 	switch action.Direction {
 	case sdk.ScaleDirectionUp:
-		return p.ScaleUp(blueprint, action.Count-servers.Count(), &opt)
+		return p.ScaleUp(ctx, &policy, pool, stopped, p.step(&policy, action.Count-current))
 	case sdk.ScaleDirectionDown:
-		return p.ScaleDown(ctx, blueprint, (action.Count-servers.Count())*-1, config)
+		return p.ScaleDown(ctx, &policy, p.step(&policy, current-action.Count), config)
 	case sdk.ScaleDirectionNone:
 		return nil
 	}
@@ -134,85 +349,291 @@ func (p *Plugin) Scale(action sdk.ScalingAction, config map[string]string) error
 	return nil
 }
 
-// ScaleUp scales up the server pool by `n` servers, options can be nil
-func (p *Plugin) ScaleUp(blueprint instance.Server, n int64, opt *instance.ServerOpt) error {
+// step returns the number of servers to add or remove out of the `n` requested, capped by the scale step of the policy.
+// The remaining servers are left for the next evaluation.
+func (p *Plugin) step(policy *Policy, n int64) int64 {
+	step := policy.Limits.Step(n)
+	if step < n {
+		p.logger.Info("Capping scaling action to the maximum scale step", "requested", n, "step", step)
+	}
+
+	return step
+}
+
+// ScaleUp scales up the server pool of existing `servers` by `n` servers spread over the policy zones.
+// The `stopped` servers are started first in order, new servers are only created once they run out.
+func (p *Plugin) ScaleUp(ctx context.Context, policy *Policy, servers, stopped instance.Servers, n int64) error {
 	num := int(n)
 	if num < 0 {
 		return fmt.Errorf("n cannot be smaller than 0, got: %d", num)
 	}
 
-	ch := make(chan int)
-	wg := p.doAsyncScale(num, p.doScaleUp(ch, blueprint, opt))
+	// New servers cannot reuse the names of stopped servers either
+	var namer *instance.Namer
+	if policy.Opt.Name.IsTemplate() {
+		namer = instance.NewNamer(policy.Opt.Name, append(append(instance.Servers{}, servers...), stopped...))
+	}
+
+	spread := policy.Zones.Spread(servers, num)
+	types := p.commercialTypes(ctx, policy, spread)
+
+	placements := make([]placement, len(spread))
+	for i, zone := range spread {
+		placements[i] = placement{index: i, zone: zone, types: types[zone]}
+	}
 
-	// Create n servers
-	for i := 0; i < num; i++ {
-		ch <- i
+	assignStopped(placements, stopped)
+
+	placements, err := p.budget(policy, servers, placements)
+	if err != nil {
+		return err
+	}
+
+	results := &Results{}
+
+	ch := make(chan placement)
+	wg := p.doAsyncScale(len(placements), policy.Limits.Creates(), p.doScaleUp(ctx, ch, results, policy, namer))
+
+	// Create or start n servers, balanced over the zones
+	for _, pl := range placements {
+		ch <- pl
 	}
 
 	close(ch)
 	wg.Wait()
 
-	return nil
+	return results.Err("up")
+}
+
+// commercialTypes returns the commercial types to try in each of the zones, ranked by availability if enabled
+func (p *Plugin) commercialTypes(ctx context.Context, policy *Policy, zones []scw.Zone) map[scw.Zone]instance.CommercialTypes {
+	types := make(map[scw.Zone]instance.CommercialTypes)
+
+	for _, zone := range zones {
+		if _, ok := types[zone]; ok {
+			continue
+		}
+
+		types[zone] = policy.CommercialTypes
+
+		if !policy.Opt.CheckAvailability || len(policy.CommercialTypes) < 2 {
+			continue
+		}
+
+		availability, err := p.api().ServerTypesAvailability(ctx, zone)
+		if err != nil {
+			p.logger.Warn("Could not check commercial type availability", "zone", zone, "error", err)
+			continue
+		}
+
+		types[zone] = policy.CommercialTypes.Rank(availability)
+	}
+
+	return types
+}
+
+// placement represents the position of a new server within a scale up, a stopped server is started instead if set
+type placement struct {
+	index   int
+	zone    scw.Zone
+	types   instance.CommercialTypes
+	stopped *instance.Server
 }
 
-// doScaleUp returns a function that can be used to asynchronously scale up
-func (p *Plugin) doScaleUp(ch chan int, blueprint instance.Server, opt *instance.ServerOpt) func() {
+// assignStopped assigns the stopped servers to the placements in order, servers in the zone of a placement are preferred.
+// Placements left without a stopped server are created instead.
+func assignStopped(placements []placement, stopped instance.Servers) {
+	available := append(instance.Servers{}, stopped...)
+
+	take := func(match func(server *instance.Server) bool) *instance.Server {
+		for i, server := range available {
+			if match(server) {
+				available = append(available[:i], available[i+1:]...)
+				return server
+			}
+		}
+
+		return nil
+	}
+
+	for i := range placements {
+		placements[i].stopped = take(func(server *instance.Server) bool { return server.Zone == placements[i].zone })
+	}
+
+	for i := range placements {
+		if placements[i].stopped == nil {
+			placements[i].stopped = take(func(*instance.Server) bool { return true })
+		}
+	}
+}
+
+// doScaleUp returns a function that can be used to asynchronously scale up, the namer can be nil
+func (p *Plugin) doScaleUp(ctx context.Context, ch chan placement, results *Results, policy *Policy, namer *instance.Namer) func() {
 	return func() {
-		for range ch {
-			_, err := p.instance.CreateServer(blueprint, opt)
+		for pl := range ch {
+			if pl.stopped != nil && p.startStopped(ctx, policy, pl.stopped) {
+				results.Add(pl.stopped.ID, nil)
+				continue
+			}
+
+			server := policy.Blueprint
+			server.Zone = pl.zone
+
+			if namer != nil {
+				name, err := namer.Next(pl.zone)
+				if err != nil {
+					results.Add(fmt.Sprintf("server #%d", pl.index), err)
+					continue
+				}
+
+				server.Name = name
+			}
+
+			start := time.Now()
+
+			server, err := p.api().CreateServerWithTypes(ctx, server, pl.types, &policy.Opt)
 			if err != nil {
-				p.logger.Error("Could not create Scaleway server", "error", err)
+				p.logger.Error("Could not create Scaleway server", "zone", pl.zone, "error", err)
+				emitFailed(policy, pl.zone, "create")
+				results.Add(fmt.Sprintf("server #%d", pl.index), err)
+				continue
 			}
+
+			emitCreated(policy, server.Zone, start)
+			results.Add(server.ID, nil)
 		}
 	}
 }
 
-// ScaleDown scales down the server pool by `n` servers
-func (p *Plugin) ScaleDown(ctx context.Context, blueprint instance.Server, n int64, config map[string]string) error {
+// startStopped starts a warm or hibernated server and returns whether it is running, servers that fail to start
+// are kept stopped
+func (p *Plugin) startStopped(ctx context.Context, policy *Policy, server *instance.Server) bool {
+	start := time.Now()
+
+	err := p.api().StartServer(ctx, server, &policy.Opt, WarmTag, HibernatedTag)
+	if err != nil {
+		p.logger.Warn("Could not start stopped Scaleway server, creating a new one instead", "id", server.ID,
+			"zone", server.Zone, "error", err)
+		emitFailed(policy, server.Zone, "start")
+
+		return false
+	}
+
+	emitStarted(policy, server.Zone, start)
+
+	return true
+}
+
+// ScaleDown scales down the server pool by `n` servers, starting with the most over-represented zones
+func (p *Plugin) ScaleDown(ctx context.Context, policy *Policy, n int64, config map[string]string) error {
 	num := int(n)
 	if num < 0 {
 		return fmt.Errorf("n cannot be smaller than 0, got: %d", n)
 	}
 
-	nodes, err := p.ClusterRunPreScaleInTasks(ctx, blueprint, config, num)
+	drained := time.Now()
+
+	nodes, servers, short, err := p.ClusterRunPreScaleInTasks(ctx, policy, config, num)
 	if err != nil {
 		return err
 	}
 
+	if short > 0 {
+		p.logger.Warn("Protected servers stopped the scale down from reaching the target", "requested", num,
+			"selected", len(nodes), "protected", short)
+	}
+
+	results := &Results{}
+
 	ch := make(chan *instance.Server)
-	wg := p.doAsyncScale(len(nodes), p.doScaleDown(ch))
+	wg := p.doAsyncScale(len(nodes), policy.Limits.Deletes(), p.doScaleDown(ctx, ch, results, policy, drained))
 
 	// Scale down nodes
 	for _, node := range nodes {
-		ch <- &instance.Server{ID: node.RemoteResourceID, Zone: blueprint.Zone}
+		ch <- &instance.Server{ID: node.RemoteResourceID, Zone: servers.WithID(node.RemoteResourceID).Zone}
 	}
 
 	close(ch)
 	wg.Wait()
 
-	err = p.cluster.RunPostScaleInTasks(ctx, config, nodes)
+	deleted, failed := p.partitionNodes(nodes, results)
+
+	// Nodes whose servers could not be removed are still alive, make them eligible again
+	if len(failed) > 0 {
+		if err := p.cluster.RunPostScaleInTasksOnFailure(failed); err != nil {
+			p.logger.Error("Could not restore eligibility of Nomad nodes", "error", err)
+		}
+	}
+
+	err = p.cluster.RunPostScaleInTasks(ctx, config, deleted)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return results.Err("down")
 }
 
-// doScaleUp returns a function that can be used to asynchronously scale down
-func (p *Plugin) doScaleDown(ch chan *instance.Server) func() {
+// doScaleDown returns a function that can be used to asynchronously scale down, the nodes of the servers
+// started draining at `drained`. Servers are hibernated or deleted depending on the scale in mode.
+func (p *Plugin) doScaleDown(ctx context.Context, ch chan *instance.Server, results *Results, policy *Policy, drained time.Time) func() {
+	if !policy.ScaleIn.Hibernates() {
+		return p.doDelete(ctx, ch, results, policy, drained)
+	}
+
 	return func() {
 		for server := range ch {
-			err := p.instance.DeleteServer(server)
+			err := p.api().StopServer(ctx, server, &policy.Opt.Timeouts, policy.ScaleIn.Mode == ScaleInPoweroff,
+				HibernatedTag, WarmTag)
 			if err != nil {
-				p.logger.Error("Could not remove Scaleway server", "error", err)
+				p.logger.Error("Could not hibernate Scaleway server", "id", server.ID, "error", err)
+				emitFailed(policy, server.Zone, "hibernate")
+			} else {
+				emitHibernated(policy, server.Zone, drained)
 			}
+
+			results.Add(server.ID, err)
+		}
+	}
+}
+
+// doDelete returns a function that can be used to asynchronously delete servers, whatever the scale in mode
+func (p *Plugin) doDelete(ctx context.Context, ch chan *instance.Server, results *Results, policy *Policy, drained time.Time) func() {
+	return func() {
+		for server := range ch {
+			err := p.api().DeleteServer(ctx, server, &policy.Opt.Timeouts, policy.Volumes.Kept()...)
+			if err != nil {
+				p.logger.Error("Could not remove Scaleway server", "id", server.ID, "error", err)
+				emitFailed(policy, server.Zone, "delete")
+			} else {
+				emitDeleted(policy, server.Zone, drained)
+			}
+
+			results.Add(server.ID, err)
+		}
+	}
+}
+
+// partitionNodes splits the nodes into those whose servers were removed and those whose servers failed to be removed
+func (p *Plugin) partitionNodes(nodes []scaleutils.NodeResourceID, results *Results) (deleted, failed []scaleutils.NodeResourceID) {
+	failures := make(map[string]bool)
+	for _, result := range results.Failed() {
+		failures[result.Server] = true
+	}
+
+	for _, node := range nodes {
+		if failures[node.RemoteResourceID] {
+			failed = append(failed, node)
+		} else {
+			deleted = append(deleted, node)
 		}
 	}
+
+	return deleted, failed
 }
 
-// doAsyncScale prepares a number of goroutines and calls the given scaling function
-func (p *Plugin) doAsyncScale(count int, fn func()) *sync.WaitGroup {
-	threads := int(math.Min(float64(count), 5))
+// doAsyncScale prepares up to `parallel` goroutines and calls the given scaling function
+func (p *Plugin) doAsyncScale(count, parallel int, fn func()) *sync.WaitGroup {
+	threads := int(math.Min(float64(count), float64(parallel)))
 
 	wg := &sync.WaitGroup{}
 	wg.Add(threads)
@@ -229,7 +650,12 @@ func (p *Plugin) doAsyncScale(count int, fn func()) *sync.WaitGroup {
 
 // Status fetches information from the Scaleway platform to be used by the Nomad autoscaler
 func (p *Plugin) Status(config map[string]string) (*sdk.TargetStatus, error) {
-	if p.State.Get() != StateIdle {
+	policy, err := p.policy(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.states.Get(policy.Key()) != StateIdle {
 		return &sdk.TargetStatus{Ready: false}, nil
 	}
 
@@ -238,65 +664,180 @@ func (p *Plugin) Status(config map[string]string) (*sdk.TargetStatus, error) {
 		return &sdk.TargetStatus{Ready: false}, err
 	}
 
-	var blueprint instance.Server
-	err = blueprint.Decode(config)
-	if err != nil {
-		return nil, err
-	}
-
 	p.logger.Debug("Fetching servers from Scaleway")
 
-	servers, err := p.instance.ListServersAll(blueprint)
+	// The listing is bound by the scale timeout of the policy, like the scaling actions
+	servers, err := p.listPool(&policy)
 	if err != nil {
 		return nil, err
 	}
 
+	servers, warm, hibernated := policy.Pool(servers), policy.Warm(servers), policy.Hibernated(servers)
+
 	p.logger.Debug("Finished fetching servers from Scaleway")
 
-	status := &sdk.TargetStatus{
-		Ready: servers.Ready(),
-		Count: servers.Count(),
+	emitPoolSize(&policy, servers)
+
+	if len(warm) != policy.WarmPool.Size {
+		p.refillWarm(policy)
+	}
+
+	health := policy.Health.Classify(servers, time.Now())
+
+	if stuck := health.Stuck(); len(stuck) > 0 {
+		p.logger.Warn("Found stuck servers", "ids", stuck.IDs())
+	}
+
+	if len(health.Replaceable()) > 0 {
+		p.replaceStuck(policy)
+	}
+
+	status := health.Status()
+	status.Meta[MetaWarm] = strconv.Itoa(len(warm))
+	status.Meta[MetaHibernated] = strconv.Itoa(len(hibernated))
+	status.Meta[MetaProtected] = strconv.Itoa(len(servers) - len(Unprotected(servers)))
+
+	if p.pricing != nil {
+		status.Meta[MetaHourlyCost] = p.poolCost(&policy, servers)
+	}
+
+	if clamp, ok := p.clamps.Load(policy.Key()); ok {
+		for k, v := range clamp.(Clamp).Meta() {
+			status.Meta[k] = v
+		}
 	}
 
 	return status, nil
 }
 
-// LookupNodeID translates a Nomad node ID to a Scaleway ID
+// LookupNodeID translates a Nomad node ID to a Scaleway ID, the node is resolved against the servers of the pools
+// whose policies the plugin has seen
 func (p *Plugin) LookupNodeID(node *api.Node) (id string, err error) {
-	name, ok := node.Attributes["unique.hostname"]
-	if !ok || len(name) == 0 {
-		return id, errors.New("attribute unique.hostname does not exist or has no value")
+	var (
+		servers instance.Servers
+		seen    = make(map[string]bool)
+		pools   int
+	)
+
+	p.policies.Range(func(_, value interface{}) bool {
+		policy := value.(Policy)
+		pools++
+
+		var pool instance.Servers
+		pool, err = p.listPool(&policy)
+		if err != nil {
+			return false
+		}
+
+		// Pools can overlap, e.g. when their blueprints only differ in the commercial type
+		for _, server := range pool {
+			if !seen[server.ID] {
+				seen[server.ID] = true
+				servers = append(servers, server)
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return id, err
 	}
 
-	blueprint := instance.Server{
-		Name: name,
+	if pools == 0 {
+		return id, fmt.Errorf("could not look up node %s, no pool policy has been seen yet", node.ID)
 	}
 
-	servers, err := p.instance.ListServersAll(blueprint)
+	return p.lookupNodeID(node, servers)
+}
+
+// poolZones returns the zones of the pools whose policies the plugin has seen
+func (p *Plugin) poolZones() (zones []scw.Zone) {
+	seen := make(map[scw.Zone]bool)
+
+	p.policies.Range(func(_, value interface{}) bool {
+		for _, zone := range value.(Policy).Zones {
+			if !seen[zone] {
+				seen[zone] = true
+				zones = append(zones, zone)
+			}
+		}
+
+		return true
+	})
+
+	return zones
+}
+
+// listPool lists the servers of the pool described by the policy in its zones, bound by its scale timeout
+func (p *Plugin) listPool(policy *Policy) (instance.Servers, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Opt.Timeouts.ScaleTimeout())
+	defer cancel()
+
+	return p.api().ListServersAll(ctx, policy.Blueprint, policy.Zones...)
+}
+
+// lookupNodeID translates a Nomad node ID to the ID of one of the given servers
+func (p *Plugin) lookupNodeID(node *api.Node, servers instance.Servers) (id string, err error) {
+	server, err := p.mapper.Resolve(node, servers)
 	if err != nil {
 		return id, err
 	}
 
-	server := servers.WithName(name)
-	if server == nil {
-		return id, fmt.Errorf("could not find server with hostname '%s'", name)
+	return server.ID, nil
+}
+
+// clusterWith returns a copy of the cluster utilities whose node lookups resolve against the given servers. Scale-ins
+// use a single listing for all of their lookups, concurrent actions on other pools never see it.
+func (p *Plugin) clusterWith(servers instance.Servers) *scaleutils.ClusterScaleUtils {
+	cluster := *p.cluster
+	cluster.ClusterNodeIDLookupFunc = func(node *api.Node) (string, error) {
+		return p.lookupNodeID(node, servers)
 	}
 
-	return server.ID, err
+	return &cluster
 }
 
 // ClusterRunPreScaleInTasks is a temporary alternative to the built-in `RunPreScaleInTasks`,
 // see https://github.com/hashicorp/nomad-autoscaler/issues/572 for more information.
-func (p *Plugin) ClusterRunPreScaleInTasks(ctx context.Context, blueprint instance.Server, config map[string]string, num int) ([]scaleutils.NodeResourceID, error) {
-	servers, err := p.instance.ListServersAll(blueprint)
+// Nodes are selected per zone, taking from the most over-represented zones first. Protected servers are
+// never selected, the number of servers they kept from being selected is returned. The returned servers
+// are all the servers listed in the zones.
+func (p *Plugin) ClusterRunPreScaleInTasks(ctx context.Context, policy *Policy, config map[string]string, num int) ([]scaleutils.NodeResourceID, instance.Servers, int, error) {
+	// List every server in the zones, nodes outside of the pool have to be resolved too
+	servers, err := p.api().ListServersAll(ctx, instance.Server{}, policy.Zones...)
 	if err != nil {
-		return nil, err
+		return nil, nil, 0, err
 	}
 
-	nodes, err := p.cluster.RunPreScaleInTasksWithRemoteCheck(ctx, config, servers.IDs(), num)
-	if err != nil {
-		return nil, err
+	cluster := p.clusterWith(servers)
+	candidates, trim, short := policy.candidates(servers, num)
+
+	var (
+		nodes []scaleutils.NodeResourceID
+		errs  []error
+	)
+
+	for _, zone := range policy.Zones {
+		n := int(math.Min(float64(trim[zone]), float64(len(candidates[zone]))))
+		if n == 0 {
+			continue
+		}
+
+		selected, err := cluster.RunPreScaleInTasksWithRemoteCheck(ctx, config, candidates[zone].IDs(), n)
+		if err != nil {
+			p.logger.Error("Could not prepare nodes for scale in", "zone", zone, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		nodes = append(nodes, selected...)
+	}
+
+	// Proceed with the nodes of the zones that succeeded
+	if len(nodes) == 0 && len(errs) > 0 {
+		return nil, nil, 0, errs[0]
 	}
 
-	return nodes, nil
+	return nodes, servers, short, nil
 }
@@ -0,0 +1,577 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/hashicorp/nomad/api"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/retry"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// TestScaleUp tests scaling up the server pool
+func TestScaleUp(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 3, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := h.Scaleway.Servers()
+	if len(servers) != 3 {
+		t.Fatalf("Expected 3 servers, got %d", len(servers))
+	}
+
+	for _, server := range servers[1:] {
+		if server.State != instance.ServerStateRunning {
+			t.Errorf("Expected server %s to be running, got %s", server.ID, server.State)
+		}
+
+		if data := h.Scaleway.UserData(server.ID); data["cloud-init"] != "#cloud-config" {
+			t.Errorf("Expected server %s to have user data, got %v", server.ID, data)
+		}
+	}
+}
+
+// TestScaleDown tests draining and deleting nodes when scaling in
+func TestScaleDown(t *testing.T) {
+	h := NewHarness(t)
+
+	for _, name := range []string{"client-0", "client-1", "client-2"} {
+		h.AddClient(name)
+	}
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 1, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Nomad.Drained()); n != 2 {
+		t.Errorf("Expected 2 drained nodes, got %d", n)
+	}
+
+	if n := len(h.Nomad.Purged()); n != 2 {
+		t.Errorf("Expected 2 purged nodes, got %d", n)
+	}
+
+	servers := h.Scaleway.Servers()
+	if len(servers) != 1 {
+		t.Fatalf("Expected 1 remaining server, got %d", len(servers))
+	}
+
+	nodes := h.Nomad.Nodes()
+	if len(nodes) != 1 {
+		t.Fatalf("Expected 1 remaining node, got %d", len(nodes))
+	}
+
+	// The remaining node must belong to the remaining server
+	if id := h.Nomad.Node(nodes[0]).Attributes["unique.hostname"]; id != servers[0].Name {
+		t.Errorf("Expected remaining node to match server %s, got %s", servers[0].Name, id)
+	}
+}
+
+// TestStatus tests reporting the pool status
+func TestStatus(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+	h.AddClient("client-1")
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Ready || status.Count != 2 {
+		t.Errorf("Expected a ready pool of 2 servers, got ready=%t count=%d", status.Ready, status.Count)
+	}
+
+	h.Scaleway.AddServer(&instance.Server{Name: "client-2", State: instance.ServerStateStarting,
+		CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler"}})
+
+	status, err = h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Ready {
+		t.Error("Expected pool with a starting server not to be ready")
+	}
+}
+
+// TestStatusTimeout tests that fetching the status is bound by the scale timeout of the policy
+func TestStatusTimeout(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+	h.Policy["scale_timeout"] = "1ns"
+
+	_, err := h.Plugin.Status(h.Policy)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the status to time out, got %v", err)
+	}
+}
+
+// TestLookupNodeID tests translating Nomad nodes to Scaleway server IDs
+func TestLookupNodeID(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+	server, node := h.AddClient("client-1")
+
+	_, err := h.Plugin.LookupNodeID(node)
+	if err == nil {
+		t.Error("Expected an error before any policy has been seen")
+	}
+
+	// Servers outside of the pool are not looked up
+	h.Scaleway.AddServer(&instance.Server{Name: "outside", State: instance.ServerStateRunning,
+		CommercialType: h.Policy["commercial_type"], Tags: []string{"other"}})
+
+	_, err = h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := h.Plugin.LookupNodeID(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != server.ID {
+		t.Errorf("Expected server ID %s, got %s", server.ID, id)
+	}
+
+	node = h.Nomad.AddNode("unknown")
+
+	_, err = h.Plugin.LookupNodeID(node)
+	if err == nil {
+		t.Error("Expected an error for a node without a matching server")
+	}
+
+	node = h.Nomad.AddNode("outside")
+
+	_, err = h.Plugin.LookupNodeID(node)
+	if err == nil {
+		t.Error("Expected an error for a node of a server outside of the pool")
+	}
+}
+
+// TestScaleUpFailure tests that failed server creations are reported
+func TestScaleUpFailure(t *testing.T) {
+	h := NewHarness(t)
+	h.Scaleway.Inject(instancetest.Fault{Method: http.MethodPost, Path: "servers", Count: 1,
+		Err: &instancetest.Error{Status: http.StatusInternalServerError, Type: "internal_error", Message: "boom"}})
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 3, Direction: sdk.ScaleDirectionUp}, h.Policy)
+
+	var scaleErr *ScaleError
+	if !errors.As(err, &scaleErr) {
+		t.Fatalf("Expected a scale error, got %v", err)
+	}
+
+	if scaleErr.Succeeded != 2 || len(scaleErr.Failed) != 1 {
+		t.Errorf("Expected 2 successes and 1 failure, got %s", scaleErr)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 2 {
+		t.Errorf("Expected 2 servers, got %d", n)
+	}
+}
+
+// TestScaleDownFailure tests that failed server removals are reported and their nodes are not purged
+func TestScaleDownFailure(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+	h.AddClient("client-1")
+
+	// Transient errors are retried, use an error that is not
+	h.Scaleway.Inject(instancetest.Fault{Method: http.MethodDelete, Path: "servers/*", Count: 1,
+		Err: &instancetest.Error{Status: http.StatusConflict, Type: "conflict", Message: "boom"}})
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 0, Direction: sdk.ScaleDirectionDown}, h.Policy)
+
+	var scaleErr *ScaleError
+	if !errors.As(err, &scaleErr) {
+		t.Fatalf("Expected a scale error, got %v", err)
+	}
+
+	if scaleErr.Succeeded != 1 || len(scaleErr.Failed) != 1 {
+		t.Errorf("Expected 1 success and 1 failure, got %s", scaleErr)
+	}
+
+	if n := len(h.Nomad.Purged()); n != 1 {
+		t.Errorf("Expected 1 purged node, got %d", n)
+	}
+
+	nodes := h.Nomad.Nodes()
+	if len(nodes) != 1 {
+		t.Fatalf("Expected 1 remaining node, got %d", len(nodes))
+	}
+
+	if e := h.Nomad.Node(nodes[0]).SchedulingEligibility; e != api.NodeSchedulingEligible {
+		t.Errorf("Expected remaining node to be eligible again, got %s", e)
+	}
+}
+
+// TestScaleDownRetry tests that transient errors of idempotent requests are retried
+func TestScaleDownRetry(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	h.Scaleway.Inject(instancetest.Fault{Method: http.MethodDelete, Path: "servers/*", Count: 2,
+		Err: &instancetest.Error{Status: http.StatusServiceUnavailable, Type: "unavailable", Message: "boom"}})
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 0, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 0 {
+		t.Errorf("Expected no servers, got %d", n)
+	}
+
+	if n := h.Scaleway.Requests(http.MethodDelete, "servers/*"); n != 3 {
+		t.Errorf("Expected 3 delete attempts, got %d", n)
+	}
+}
+
+// TestScaleUpNameTemplate tests that every server gets a unique name rendered from the template
+func TestScaleUpNameTemplate(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["name"] = "nomad-client-{{index}}"
+	h.AddClient("nomad-client-0")
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 4, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]bool)
+	for _, server := range h.Scaleway.Servers() {
+		if names[server.Name] {
+			t.Errorf("Expected unique names, got %s twice", server.Name)
+		}
+
+		names[server.Name] = true
+	}
+
+	for _, name := range []string{"nomad-client-0", "nomad-client-1", "nomad-client-2", "nomad-client-3"} {
+		if !names[name] {
+			t.Errorf("Expected server %s to exist", name)
+		}
+	}
+}
+
+// TestScaleDownNodeMeta tests that nodes are mapped by their meta key using a single listing
+func TestScaleDownNodeMeta(t *testing.T) {
+	h := NewHarness(t)
+
+	// All servers share the same name, only the meta key identifies them
+	var servers []*instance.Server
+	for i := 0; i < 3; i++ {
+		server, node := h.AddClient("client")
+		node.Meta = map[string]string{"scaleway_server_id": server.ID}
+		servers = append(servers, server)
+	}
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 1, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := h.Scaleway.Servers()
+	if len(remaining) != 1 {
+		t.Fatalf("Expected 1 remaining server, got %d", len(remaining))
+	}
+
+	node := h.Nomad.Node(h.Nomad.Nodes()[0])
+	if node.Meta["scaleway_server_id"] != remaining[0].ID {
+		t.Errorf("Expected remaining node to belong to server %s", remaining[0].ID)
+	}
+
+	// One listing to compute the scaling delta and one shared by all node lookups, each ending in an empty page
+	if n := h.Scaleway.Requests(http.MethodGet, "servers"); n != 4 {
+		t.Errorf("Expected 4 list requests, got %d", n)
+	}
+}
+
+// TestScaleUpZones tests spreading new servers over multiple zones
+func TestScaleUpZones(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["zones"] = "fr-par-1,fr-par-2,nl-ams-1"
+
+	h.AddZoneClient(scw.ZoneNlAms1, "client-0")
+	h.AddZoneClient(scw.ZoneNlAms1, "client-1")
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 6, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[scw.Zone]int)
+	for _, server := range h.Scaleway.Servers() {
+		counts[server.Zone]++
+	}
+
+	for _, zone := range []scw.Zone{scw.ZoneFrPar1, scw.ZoneFrPar2, scw.ZoneNlAms1} {
+		if counts[zone] != 2 {
+			t.Errorf("Expected 2 servers in %s, got %d", zone, counts[zone])
+		}
+	}
+}
+
+// TestScaleDownZones tests removing servers from the most over-represented zone first
+func TestScaleDownZones(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["zones"] = "fr-par-1,nl-ams-1"
+
+	for _, name := range []string{"client-0", "client-1", "client-2"} {
+		h.AddZoneClient(scw.ZoneFrPar1, name)
+	}
+
+	h.AddZoneClient(scw.ZoneNlAms1, "client-3")
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 2, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[scw.Zone]int)
+	for _, server := range h.Scaleway.Servers() {
+		counts[server.Zone]++
+	}
+
+	if counts[scw.ZoneFrPar1] != 1 || counts[scw.ZoneNlAms1] != 1 {
+		t.Errorf("Expected 1 server in each zone, got %v", counts)
+	}
+
+	if n := len(h.Nomad.Nodes()); n != 2 {
+		t.Errorf("Expected 2 remaining nodes, got %d", n)
+	}
+}
+
+// TestScaleUpCommercialTypes tests skipping commercial types that are out of stock
+func TestScaleUpCommercialTypes(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	h.Policy["commercial_type"] = "DEV1-S,DEV1-M"
+	h.Policy["check_availability"] = "true"
+
+	h.Scaleway.SetAvailability(instancetest.DefaultZone, "DEV1-S", instance.ServerTypesAvailabilityShortage)
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 3, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := h.Scaleway.Servers()
+	if len(servers) != 3 {
+		t.Fatalf("Expected 3 servers, got %d", len(servers))
+	}
+
+	for _, server := range servers[1:] {
+		if server.CommercialType != "DEV1-M" {
+			t.Errorf("Expected server %s to be a DEV1-M, got %s", server.ID, server.CommercialType)
+		}
+	}
+
+	// The availability check prevents attempts with the type in shortage
+	if n := h.Scaleway.Requests(http.MethodPost, "servers"); n != 2 {
+		t.Errorf("Expected 2 create requests, got %d", n)
+	}
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Count != 3 {
+		t.Errorf("Expected a count of 3 across commercial types, got %d", status.Count)
+	}
+}
+
+// TestScaleUpImageSelector tests creating servers from the newest private image matching the selector, the image is
+// resolved once for subsequent scaling actions
+func TestScaleUpImageSelector(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	h.Policy["image"] = "tag:nomad-client"
+
+	h.Scaleway.SetArch("DEV1-S", instance.ArchX86_64)
+
+	old, newest := time.Now().Add(-time.Hour), time.Now()
+	h.Scaleway.AddImage(&instance.Image{Name: "nomad-client-1", CreationDate: &old, Tags: []string{"nomad-client"}})
+	image := h.Scaleway.AddImage(&instance.Image{Name: "nomad-client-2", CreationDate: &newest,
+		Tags: []string{"nomad-client"}})
+
+	for _, count := range []int64{2, 3} {
+		err := h.Plugin.Scale(sdk.ScalingAction{Count: count, Direction: sdk.ScaleDirectionUp}, h.Policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	servers := h.Scaleway.Servers()
+	if len(servers) != 3 {
+		t.Fatalf("Expected 3 servers, got %d", len(servers))
+	}
+
+	for _, server := range servers[1:] {
+		if server.Image == nil || server.Image.ID != image.ID {
+			t.Errorf("Expected server %s to be created from image %s, got %v", server.ID, image.ID, server.Image)
+		}
+	}
+
+	if n := h.Scaleway.Requests(http.MethodGet, "images"); n != 1 {
+		t.Errorf("Expected the images to be listed once, got %d", n)
+	}
+}
+
+// TestScaleDownKeepVolumes tests that data volumes marked to be kept survive a scale in
+func TestScaleDownKeepVolumes(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["name"] = "client-{{index}}"
+	h.Policy["data_volumes"] = "10:l_ssd:keep,10:l_ssd"
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 2, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, server := range h.Scaleway.Servers() {
+		h.Nomad.AddNode(server.Name)
+	}
+
+	if n := len(h.Scaleway.Volumes()); n != 6 {
+		t.Fatalf("Expected 6 volumes, got %d", n)
+	}
+
+	err = h.Plugin.Scale(sdk.ScalingAction{Count: 0, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumes := h.Scaleway.Volumes()
+	if len(volumes) != 2 {
+		t.Fatalf("Expected 2 kept volumes, got %d", len(volumes))
+	}
+
+	for _, volume := range volumes {
+		if volume.Server != nil {
+			t.Errorf("Expected kept volume %s to be detached", volume.ID)
+		}
+	}
+}
+
+// TestScaleConcurrent tests that concurrent scaling actions on the same pool are serialized
+func TestScaleConcurrent(t *testing.T) {
+	h := NewHarness(t)
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- h.Plugin.Scale(sdk.ScalingAction{Count: 3, Direction: sdk.ScaleDirectionUp}, h.Policy)
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 3 {
+		t.Errorf("Expected 3 servers, got %d", n)
+	}
+}
+
+// TestScaleMaxScaleStep tests that scaling actions are capped by the maximum scale step
+func TestScaleMaxScaleStep(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["max_scale_step"] = "3"
+	h.Policy["max_parallel_creates"] = "10"
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 8, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 3 {
+		t.Fatalf("Expected 3 servers after the first step, got %d", n)
+	}
+
+	err = h.Plugin.Scale(sdk.ScalingAction{Count: 8, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 6 {
+		t.Errorf("Expected 6 servers after the second step, got %d", n)
+	}
+}
+
+// TestDoAsyncScale tests that the number of workers is capped by the parallelism
+func TestDoAsyncScale(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		workers int
+	)
+
+	p := New(hclog.NewNullLogger())
+	p.doAsyncScale(10, 3, func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		workers++
+	}).Wait()
+
+	if workers != 3 {
+		t.Errorf("Expected 3 workers, got %d", workers)
+	}
+
+	workers = 0
+
+	p.doAsyncScale(2, 3, func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		workers++
+	}).Wait()
+
+	if workers != 2 {
+		t.Errorf("Expected 2 workers, got %d", workers)
+	}
+}
+
+// TestSetConfigAttemptTimeout tests that the attempt timeout of the Scaleway API requests is configurable
+func TestSetConfigAttemptTimeout(t *testing.T) {
+	h := NewHarness(t)
+
+	if h.Plugin.transport.Config.AttemptTimeout != retry.DefaultAttemptTimeout {
+		t.Errorf("Expected the default attempt timeout, got %s", h.Plugin.transport.Config.AttemptTimeout)
+	}
+
+	err := h.Plugin.SetConfig(map[string]string{
+		"access_key":      instancetest.AccessKey,
+		"secret_key":      instancetest.SecretKey,
+		"nomad_address":   h.Nomad.URL,
+		"attempt_timeout": "5s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Plugin.transport.Config.AttemptTimeout != time.Second*5 {
+		t.Errorf("Expected an attempt timeout of 5s, got %s", h.Plugin.transport.Config.AttemptTimeout)
+	}
+}
@@ -0,0 +1,171 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// Policy represents the target configuration of a scaling policy
+type Policy struct {
+	Blueprint       instance.Server
+	Caps            Caps
+	Opt             instance.ServerOpt
+	Zones           instance.Zones
+	CommercialTypes instance.CommercialTypes
+	Volumes         instance.Volumes
+	Limits          Limits
+	Health          HealthPolicy
+	WarmPool        WarmPool
+	ScaleIn         ScaleIn
+}
+
+// Decode decodes a map of strings into a policy
+func (p *Policy) Decode(config map[string]string) error {
+	err := p.Blueprint.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = p.Caps.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = p.Opt.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = p.Zones.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = p.CommercialTypes.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = p.Volumes.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = p.Limits.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = p.Health.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	err = p.WarmPool.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	return p.ScaleIn.Decode(config)
+}
+
+// Pool filters the slice into a subslice of servers that belong to the pool, in any of its zones.
+// Warm and hibernated servers are not part of the pool, see `Warm` and `Hibernated`.
+func (p *Policy) Pool(servers instance.Servers) (r instance.Servers) {
+	for _, server := range p.members(servers) {
+		if !server.HasTag(WarmTag) && !server.HasTag(HibernatedTag) {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// members filters the slice into a subslice of servers matching the policy in any of its zones, including warm and
+// hibernated servers
+func (p *Policy) members(servers instance.Servers) (r instance.Servers) {
+	blueprint := p.Blueprint
+	blueprint.Zone = ""
+
+	for _, server := range p.CommercialTypes.Filter(servers.Matching(blueprint)) {
+		if p.Zones.Contains(server.Zone) {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// ZonePool filters the slice into a subslice of servers that belong to the pool in the given zone
+func (p *Policy) ZonePool(servers instance.Servers, zone scw.Zone) (r instance.Servers) {
+	for _, server := range p.Pool(servers) {
+		if server.Zone == zone {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// Key returns a stable hash identifying the server pool of the policy, independent of the order of list options
+func (p *Policy) Key() string {
+	sorted := func(s []string) string {
+		s = append([]string{}, s...)
+		sort.Strings(s)
+
+		return strings.Join(s, ",")
+	}
+
+	zones := make([]string, len(p.Zones))
+	for i, zone := range p.Zones {
+		zones[i] = string(zone)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "name=%s\ntags=%s\nzones=%s\ncommercial_types=%s\n", p.Blueprint.Name, sorted(p.Blueprint.Tags),
+		sorted(zones), sorted(p.CommercialTypes))
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// policy decodes the policy of the configuration and completes it with the plugin configuration, limits that are
+// not set in the policy fall back to the plugin limits and pools without a zone use the default zone of the client.
+// The policy is remembered by key for the node lookups outside of scaling actions.
+func (p *Plugin) policy(config map[string]string) (Policy, error) {
+	var (
+		policy Policy
+		zone   scw.Zone
+	)
+
+	err := policy.Decode(config)
+	if err != nil {
+		return policy, err
+	}
+
+	policy.Limits = policy.Limits.Merge(p.limits)
+
+	p.mu.RLock()
+	policy.Opt.Images, zone = p.images, p.zone
+	p.mu.RUnlock()
+
+	// Pools without a zone are placed in the default zone of the client
+	if len(policy.Zones) == 0 {
+		if len(zone) == 0 {
+			return policy, errors.New("a zone is required, set zone or zones in the policy or a default Scaleway zone")
+		}
+
+		policy.Zones = instance.Zones{zone}
+		policy.Blueprint.Zone = zone
+	}
+
+	p.policies.Store(policy.Key(), policy)
+
+	return policy, nil
+}
@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+)
+
+// TestPolicyKey tests that the pool key is stable and identifies the pool
+func TestPolicyKey(t *testing.T) {
+	key := func(config map[string]string) string {
+		config["image"] = "0d1cf4a3-aae9-4294-9fd9-fefffb297615"
+
+		var policy Policy
+		if err := policy.Decode(config); err != nil {
+			t.Fatal(err)
+		}
+
+		return policy.Key()
+	}
+
+	a := key(map[string]string{"zones": "fr-par-1,nl-ams-1", "tags": "web,blue", "commercial_type": "DEV1-S"})
+	b := key(map[string]string{"zones": "nl-ams-1,fr-par-1", "tags": "blue,web", "commercial_type": "DEV1-S",
+		"user_data": "foo=bar"})
+	c := key(map[string]string{"zones": "fr-par-1", "tags": "web,blue", "commercial_type": "DEV1-S"})
+
+	if a != b {
+		t.Errorf("Expected the same pool to have the same key, got %s and %s", a, b)
+	}
+
+	if a == c {
+		t.Errorf("Expected different pools to have different keys, got %s", a)
+	}
+}
+
+// TestScaleDefaultZone tests that policies without a zone scale in the default zone of the client
+func TestScaleDefaultZone(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	delete(h.Policy, "zone")
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 2, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := h.Scaleway.Servers()
+	if len(servers) != 2 {
+		t.Fatalf("Expected 2 servers, got %d", len(servers))
+	}
+
+	if servers[1].Zone != instancetest.DefaultZone {
+		t.Errorf("Expected the new server in %s, got %s", instancetest.DefaultZone, servers[1].Zone)
+	}
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Count != 2 {
+		t.Errorf("Expected a count of 2, got %d", status.Count)
+	}
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// ProtectedTag is the tag of the servers that are never chosen for termination
+const ProtectedTag = "autoscaler:protected"
+
+// MetaProtected is the status meta key of the number of protected servers
+const MetaProtected = "scaleway_protected"
+
+// Protected returns whether the server is protected from termination, either by the protected tag or by
+// the Scaleway protection option
+func Protected(server *instance.Server) bool {
+	return server.Protected || server.HasTag(ProtectedTag)
+}
+
+// Unprotected filters the slice into a subslice of servers that are not protected
+func Unprotected(servers instance.Servers) (r instance.Servers) {
+	for _, server := range servers {
+		if !Protected(server) {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// candidates returns the servers of each zone that can be removed and the amount to remove from each zone to
+// shrink the pool by `n` servers. Protected servers count towards the balance of their zone but are never removed,
+// zones that run out of unprotected servers are trimmed in favour of the other zones. The number of servers that
+// could not be removed because of protected servers is returned too.
+func (p *Policy) candidates(servers instance.Servers, n int) (r map[scw.Zone]instance.Servers, trim map[scw.Zone]int, short int) {
+	r = make(map[scw.Zone]instance.Servers)
+	available := make(map[scw.Zone]int)
+
+	for _, zone := range p.Zones {
+		r[zone] = Unprotected(p.ZonePool(servers, zone))
+		available[zone] = len(r[zone])
+	}
+
+	pool := p.Pool(servers)
+	trim, short = p.Zones.TrimWithin(pool, available, n)
+
+	// Servers missing from the pool are not kept by protected servers
+	if protected := len(pool) - len(Unprotected(pool)); short > protected {
+		short = protected
+	}
+
+	return r, trim, short
+}
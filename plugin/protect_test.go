@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// TestScaleDownProtected tests that protected servers are never removed but still counted
+func TestScaleDownProtected(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	// One server is protected by the tag and one by the Scaleway protection option
+	tagged := h.Scaleway.AddServer(&instance.Server{Name: "client-1", Hostname: "client-1",
+		CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler", ProtectedTag}})
+	h.Nomad.AddNode("client-1")
+
+	flagged := h.Scaleway.AddServer(&instance.Server{Name: "client-2", Hostname: "client-2", Protected: true,
+		CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler"}})
+	h.Nomad.AddNode("client-2")
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Count != 3 || status.Meta[MetaProtected] != "2" {
+		t.Errorf("Expected 3 servers of which 2 protected, got count=%d meta=%v", status.Count, status.Meta)
+	}
+
+	// Only the unprotected server can be removed
+	err = h.Plugin.Scale(sdk.ScalingAction{Count: 0, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := h.Scaleway.Servers()
+	if len(servers) != 2 {
+		t.Fatalf("Expected the 2 protected servers to remain, got %d servers", len(servers))
+	}
+
+	for _, id := range []string{tagged.ID, flagged.ID} {
+		if h.Scaleway.GetServer(id) == nil {
+			t.Errorf("Expected protected server %s to remain", id)
+		}
+	}
+
+	if n := len(h.Nomad.Drained()); n != 1 {
+		t.Errorf("Expected 1 drained node, got %d", n)
+	}
+}
+
+// TestScaleDownProtectedZones tests that the servers a zone cannot remove because of protected servers are removed
+// from the other zones instead
+func TestScaleDownProtectedZones(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["zones"] = "fr-par-1,nl-ams-1"
+
+	// fr-par-1 is over-represented but holds a single unprotected server
+	for _, name := range []string{"client-0", "client-1", "client-2"} {
+		h.Scaleway.AddServer(&instance.Server{Zone: scw.ZoneFrPar1, Name: name, Hostname: name,
+			CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler", ProtectedTag}})
+		h.Nomad.AddNode(name)
+	}
+
+	h.AddZoneClient(scw.ZoneFrPar1, "client-3")
+	h.AddZoneClient(scw.ZoneNlAms1, "client-4")
+	h.AddZoneClient(scw.ZoneNlAms1, "client-5")
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 4, Direction: sdk.ScaleDirectionDown}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[scw.Zone]int)
+	for _, server := range h.Scaleway.Servers() {
+		counts[server.Zone]++
+	}
+
+	if counts[scw.ZoneFrPar1] != 3 || counts[scw.ZoneNlAms1] != 1 {
+		t.Errorf("Expected the protected servers of fr-par-1 and 1 server of nl-ams-1 to remain, got %v", counts)
+	}
+}
@@ -0,0 +1,232 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+	"github.com/karelorigin/nomad-scaleway-target/types"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// DefaultReaperGracePeriod is the default age a server needs before it can be considered orphaned
+const DefaultReaperGracePeriod = time.Minute * 30
+
+// ReaperConfig represents the orphaned server reaper configuration, a zero interval disables the reaper
+type ReaperConfig struct {
+	Interval    time.Duration     `mapstructure:"reaper_interval"`
+	GracePeriod time.Duration     `mapstructure:"reaper_grace_period"`
+	Terminate   types.Bool        `mapstructure:"reaper_terminate"`
+	Zones       types.SliceString `mapstructure:"reaper_zones"`
+	AuditLog    string            `mapstructure:"audit_log"`
+}
+
+// Validate returns an error if one of the reaper zones is invalid
+func (c *ReaperConfig) Validate() error {
+	for _, zone := range c.Zones {
+		if _, err := scw.ParseZone(zone); err != nil {
+			return fmt.Errorf("invalid reaper zone '%s': %w", zone, err)
+		}
+	}
+
+	return nil
+}
+
+// Reaper periodically finds autoscaled servers without a matching Nomad node, e.g. because their bootstrap failed
+type Reaper struct {
+	config   ReaperConfig
+	logger   hclog.Logger
+	instance func() *instance.API
+	zones    func() []scw.Zone
+	nomad    *api.Client
+	mapper   *NodeMapper
+	audit    *AuditLog
+	now      func() time.Time
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// NewReaper returns a new reaper, call Start to run it periodically. Without reaper zones, the reaper searches the
+// zones returned by `zones` or the default zone of the client if there are none.
+func NewReaper(config ReaperConfig, logger hclog.Logger, instance func() *instance.API, zones func() []scw.Zone, nomad *api.Client, mapper *NodeMapper, audit *AuditLog) *Reaper {
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = DefaultReaperGracePeriod
+	}
+
+	return &Reaper{
+		config:   config,
+		logger:   logger.Named("reaper"),
+		instance: instance,
+		zones:    zones,
+		nomad:    nomad,
+		mapper:   mapper,
+		audit:    audit,
+		now:      time.Now,
+	}
+}
+
+// Start runs the reaper in the background every interval until stopped, a zero interval does nothing
+func (r *Reaper) Start() {
+	if r.config.Interval <= 0 {
+		return
+	}
+
+	r.stop = make(chan struct{})
+	r.done.Add(1)
+
+	go func() {
+		defer r.done.Done()
+
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), r.config.Interval)
+			_, err := r.Reap(ctx)
+			cancel()
+
+			if err != nil {
+				r.logger.Error("Could not reap orphaned servers", "error", err)
+			}
+		}
+	}()
+}
+
+// Stop stops the background reaper and waits for a running pass to finish
+func (r *Reaper) Stop() {
+	if r.stop == nil {
+		return
+	}
+
+	close(r.stop)
+	r.done.Wait()
+	r.stop = nil
+}
+
+// Reap finds the orphaned servers and terminates them if enabled, the orphans are returned. Nothing is terminated
+// if any Nomad node could not be mapped to a server, its server would be mistaken for an orphan.
+func (r *Reaper) Reap(ctx context.Context) (instance.Servers, error) {
+	orphans, unmapped, err := r.Orphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	terminate := bool(r.config.Terminate)
+	if terminate && unmapped > 0 && len(orphans) > 0 {
+		r.logger.Warn("Not terminating orphaned servers, some Nomad nodes could not be mapped to a server",
+			"unmapped", unmapped)
+
+		terminate = false
+	}
+
+	for _, server := range orphans {
+		entry := AuditEntry{ServerID: server.ID, Name: server.Name, Zone: string(server.Zone),
+			Reason: fmt.Sprintf("no Nomad node after %s", r.config.GracePeriod)}
+
+		r.logger.Warn("Found orphaned server", "id", server.ID, "name", server.Name, "zone", server.Zone)
+
+		entry.Action = AuditOrphanFound
+		r.audit.Record(entry)
+
+		// Protected servers are reported but never terminated
+		if !terminate || Protected(server) {
+			continue
+		}
+
+		err := r.instance().DeleteServer(ctx, server, nil, dataVolumes(server)...)
+		if err != nil {
+			r.logger.Error("Could not terminate orphaned server", "id", server.ID, "error", err)
+
+			entry.Action, entry.Error = AuditOrphanFailed, err.Error()
+			r.audit.Record(entry)
+
+			continue
+		}
+
+		entry.Action = AuditOrphanTerminated
+		r.audit.Record(entry)
+	}
+
+	return orphans, nil
+}
+
+// Orphans returns the running autoscaled servers older than the grace period that no Nomad node maps to, together
+// with the number of nodes that could not be mapped to a server. Stopped servers are never orphans, they are not
+// expected to run a Nomad client.
+func (r *Reaper) Orphans(ctx context.Context) (orphans instance.Servers, unmapped int, err error) {
+	zones := r.zones()
+	if len(r.config.Zones) > 0 {
+		zones = make([]scw.Zone, len(r.config.Zones))
+		for i, zone := range r.config.Zones {
+			zones[i], _ = scw.ParseZone(zone)
+		}
+	}
+
+	servers, err := r.instance().ListServersAll(ctx, instance.Server{Tags: instance.DefaultTags}, zones...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Nodes have to be listed after the servers, so that servers registering in between are not reaped
+	stubs, _, err := r.nomad.Nodes().List((&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matched := make(map[string]bool)
+
+	for _, stub := range stubs {
+		node, _, err := r.nomad.Nodes().Info(stub.ID, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		server, err := r.mapper.Resolve(node, servers)
+		if err != nil {
+			r.logger.Debug("Could not map node to a server", "node_id", node.ID, "error", err)
+			unmapped++
+			continue
+		}
+
+		matched[server.ID] = true
+	}
+
+	for _, server := range servers {
+		if matched[server.ID] || server.Stopped() || !r.expired(server) {
+			continue
+		}
+
+		orphans = append(orphans, server)
+	}
+
+	return orphans, unmapped, nil
+}
+
+// dataVolumes returns the template keys of the data volumes of the server. The reaper cannot tell which policy
+// created a server, so its data volumes are kept in case the policy marks them as kept.
+func dataVolumes(server *instance.Server) (keys []string) {
+	for key := range server.Volumes {
+		if key != "0" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// expired returns whether the server is older than the grace period
+func (r *Reaper) expired(server *instance.Server) bool {
+	return server.CreationDate != nil && r.now().Sub(*server.CreationDate) > r.config.GracePeriod
+}
@@ -0,0 +1,211 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/karelorigin/nomad-scaleway-target/types"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// TestReaper tests finding and terminating orphaned servers
+func TestReaper(t *testing.T) {
+	h := NewHarness(t)
+	old := time.Now().Add(-time.Hour)
+
+	registered, _ := h.AddClient("client-0")
+	orphan := h.Scaleway.AddServer(&instance.Server{Name: "orphan", CreationDate: &old,
+		Tags: []string{"nomad", "client", "autoscaler"}})
+
+	// Young, stopped and unmanaged servers are never orphans
+	h.Scaleway.AddServer(&instance.Server{Name: "young", Tags: []string{"nomad", "client", "autoscaler"}})
+	h.Scaleway.AddServer(&instance.Server{Name: "stopped", CreationDate: &old, State: instance.ServerStateStopped,
+		Tags: []string{"nomad", "client", "autoscaler"}})
+	h.Scaleway.AddServer(&instance.Server{Name: "unmanaged", CreationDate: &old, Tags: []string{"web"}})
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	audit, err := NewAuditLog(path, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reaper := h.Plugin.reaper
+	reaper.audit = audit
+
+	orphans, err := reaper.Reap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(orphans) != 1 || orphans[0].ID != orphan.ID {
+		t.Fatalf("Expected server %s to be the only orphan, got %v", orphan.ID, orphans.IDs())
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 5 {
+		t.Errorf("Expected orphans to be kept unless termination is enabled, got %d servers", n)
+	}
+
+	reaper.config.Terminate = true
+
+	_, err = reaper.Reap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Scaleway.GetServer(orphan.ID) != nil {
+		t.Error("Expected the orphan to be terminated")
+	}
+
+	if h.Scaleway.GetServer(registered.ID) == nil {
+		t.Error("Expected the registered server to be kept")
+	}
+
+	audit.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var actions []string
+
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.ServerID != orphan.ID {
+			t.Errorf("Expected audit entries for server %s only, got %s", orphan.ID, entry.ServerID)
+		}
+
+		actions = append(actions, entry.Action)
+	}
+
+	expected := []string{AuditOrphanFound, AuditOrphanFound, AuditOrphanTerminated}
+	if len(actions) != len(expected) {
+		t.Fatalf("Expected audit actions %v, got %v", expected, actions)
+	}
+
+	for i := range expected {
+		if actions[i] != expected[i] {
+			t.Errorf("Expected audit actions %v, got %v", expected, actions)
+			break
+		}
+	}
+}
+
+// TestReaperUnmappedNodes tests that nothing is terminated while a Nomad node cannot be mapped to a server
+func TestReaperUnmappedNodes(t *testing.T) {
+	h := NewHarness(t)
+	old := time.Now().Add(-time.Hour)
+
+	// Two servers share the hostname of a registered node, neither can be told apart
+	for i := 0; i < 2; i++ {
+		h.Scaleway.AddServer(&instance.Server{Name: "client", Hostname: "client", CreationDate: &old,
+			Tags: []string{"nomad", "client", "autoscaler"}})
+	}
+
+	h.Nomad.AddNode("client")
+
+	reaper := h.Plugin.reaper
+	reaper.config.Terminate = true
+
+	orphans, err := reaper.Reap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(orphans) != 2 {
+		t.Errorf("Expected both servers to be reported, got %v", orphans.IDs())
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 2 {
+		t.Errorf("Expected no server to be terminated, got %d servers", n)
+	}
+}
+
+// TestReaperDataVolumes tests that the data volumes of terminated orphans are kept
+func TestReaperDataVolumes(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["data_volumes"] = "10:l_ssd"
+
+	// The new server never registers with Nomad
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 1, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reaper := h.Plugin.reaper
+	reaper.config.Terminate = true
+	reaper.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	orphans, err := reaper.Reap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(orphans) != 1 || len(h.Scaleway.Servers()) != 0 {
+		t.Fatalf("Expected the orphan to be terminated, got %v and %d servers", orphans.IDs(), len(h.Scaleway.Servers()))
+	}
+
+	volumes := h.Scaleway.Volumes()
+	if len(volumes) != 1 {
+		t.Fatalf("Expected the data volume to be kept, got %d volumes", len(volumes))
+	}
+
+	if volumes[0].Server != nil {
+		t.Errorf("Expected the data volume to be detached")
+	}
+}
+
+// TestReaperPolicyZones tests that the reaper searches the zones of the known pools without reaper zones
+func TestReaperPolicyZones(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["zones"] = "fr-par-1,nl-ams-1"
+	old := time.Now().Add(-time.Hour)
+
+	orphan := h.Scaleway.AddServer(&instance.Server{Zone: scw.ZoneNlAms1, Name: "orphan", CreationDate: &old,
+		Tags: []string{"nomad", "client", "autoscaler"}})
+
+	_, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := h.Plugin.reaper.Reap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(orphans) != 1 || orphans[0].ID != orphan.ID {
+		t.Errorf("Expected server %s in the second zone of the pool to be an orphan, got %v", orphan.ID, orphans.IDs())
+	}
+}
+
+// TestReaperConfigZones tests that invalid reaper zones are rejected
+func TestReaperConfigZones(t *testing.T) {
+	config := ReaperConfig{Zones: types.SliceString{"fr-par-1", "par1"}}
+
+	err := config.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Zones = append(config.Zones, "fr-par")
+
+	err = config.Validate()
+	if err == nil {
+		t.Error("Expected an error for an invalid zone")
+	}
+}
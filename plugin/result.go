@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Result represents the outcome of scaling a single server
+type Result struct {
+	Server string
+	Err    error
+}
+
+// Results collects the outcome of concurrent scaling operations
+type Results struct {
+	mu        sync.Mutex
+	succeeded []string
+	failed    []Result
+}
+
+// Add records the outcome for the given server, a nil error counts as a success
+func (r *Results) Add(server string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.failed = append(r.failed, Result{Server: server, Err: err})
+		return
+	}
+
+	r.succeeded = append(r.succeeded, server)
+}
+
+// Succeeded returns the servers that were scaled successfully
+func (r *Results) Succeeded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.succeeded...)
+}
+
+// Failed returns the servers that could not be scaled
+func (r *Results) Failed() []Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Result{}, r.failed...)
+}
+
+// Err returns a `*ScaleError` if any of the operations failed, or nil otherwise
+func (r *Results) Err(direction string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.failed) == 0 {
+		return nil
+	}
+
+	return &ScaleError{
+		Direction: direction,
+		Succeeded: len(r.succeeded),
+		Failed:    append([]Result{}, r.failed...),
+	}
+}
+
+// ScaleError represents a scaling action in which one or more servers failed to scale
+type ScaleError struct {
+	Direction string
+	Succeeded int
+	Failed    []Result
+}
+
+// Error satisfies the error interface
+func (e *ScaleError) Error() string {
+	reasons := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		reasons[i] = fmt.Sprintf("%s: %s", f.Server, f.Err)
+	}
+
+	return fmt.Sprintf("scale %s: %d of %d servers succeeded, %d failed: %s", e.Direction, e.Succeeded,
+		e.Succeeded+len(e.Failed), len(e.Failed), strings.Join(reasons, "; "))
+}
@@ -0,0 +1,27 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestResults tests collecting scaling results
+func TestResults(t *testing.T) {
+	var results Results
+	if results.Err("up") != nil {
+		t.Error("Expected no error without results")
+	}
+
+	results.Add("a", nil)
+	results.Add("b", errors.New("out of stock"))
+
+	err := results.Err("up")
+	if err == nil {
+		t.Fatal("Expected an error after a failure")
+	}
+
+	expected := "scale up: 1 of 2 servers succeeded, 1 failed: b: out of stock"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err)
+	}
+}
@@ -1,6 +1,16 @@
 package plugin
 
-import "sync/atomic"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A set of default delays of background pool tasks that failed
+const (
+	DefaultBackoffMin = time.Second * 30
+	DefaultBackoffMax = time.Minute * 30
+)
 
 // State represents a plugin state
 type State int32
@@ -25,3 +35,143 @@ func (s *State) SetActive() {
 func (s *State) Get() State {
 	return State(atomic.LoadInt32((*int32)(s)))
 }
+
+// States tracks the state of each server pool by key, scaling actions on the same pool are serialized
+type States struct {
+	mu    sync.Mutex
+	pools map[string]*poolState
+}
+
+// poolState holds the lock of a single pool, its state and the number of scaling actions holding or waiting for it
+type poolState struct {
+	sync.Mutex
+	refs  int
+	state State
+}
+
+// Acquire waits until the pool with the given key is no longer scaling and marks it active,
+// the returned function releases the pool again
+func (s *States) Acquire(key string) (release func()) {
+	s.mu.Lock()
+
+	if s.pools == nil {
+		s.pools = make(map[string]*poolState)
+	}
+
+	ps, ok := s.pools[key]
+	if !ok {
+		ps = &poolState{}
+		ps.state.SetActive()
+		s.pools[key] = ps
+	}
+
+	ps.refs++
+
+	s.mu.Unlock()
+
+	ps.Lock()
+
+	return func() {
+		ps.Unlock()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if ps.refs--; ps.refs == 0 {
+			ps.state.SetIdle()
+			delete(s.pools, key)
+		}
+	}
+}
+
+// Get returns the state of the pool with the given key, pools with pending scaling actions are active
+func (s *States) Get(key string) State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ps, ok := s.pools[key]; ok {
+		return ps.state.Get()
+	}
+
+	return StateIdle
+}
+
+// Backoff delays the retries of failing background tasks per pool key, the delay doubles on every consecutive
+// failure from Min up to Max. The zero value uses the default delays.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	mu       sync.Mutex
+	failures map[string]backoffState
+	now      func() time.Time
+}
+
+// backoffState holds the consecutive failures of a single pool and the time until which it is not retried
+type backoffState struct {
+	attempts int
+	until    time.Time
+}
+
+// Ready returns whether the task of the pool with the given key can run
+func (b *Backoff) Ready(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, ok := b.failures[key]
+
+	return !ok || !b.time().Before(f.until)
+}
+
+// Fail records a failure of the task of the pool with the given key and returns the delay until it is retried
+func (b *Backoff) Fail(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures == nil {
+		b.failures = make(map[string]backoffState)
+	}
+
+	min, max := b.Min, b.Max
+	if min <= 0 {
+		min = DefaultBackoffMin
+	}
+
+	if max <= 0 {
+		max = DefaultBackoffMax
+	}
+
+	f := b.failures[key]
+	f.attempts++
+
+	d := min
+	for i := 1; i < f.attempts && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	f.until = b.time().Add(d)
+	b.failures[key] = f
+
+	return d
+}
+
+// Reset clears the failures of the pool with the given key
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failures, key)
+}
+
+// time returns the current time
+func (b *Backoff) time() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+
+	return time.Now()
+}
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"testing"
+	"time"
 )
 
 // TestState tests switching states
@@ -21,3 +22,81 @@ func TestState(t *testing.T) {
 		t.Error("Expected state to be idle after SetIdle")
 	}
 }
+
+// TestStates tests serializing actions on the same pool while other pools remain idle
+func TestStates(t *testing.T) {
+	var states States
+
+	release := states.Acquire("a")
+
+	if states.Get("a") != StateActive {
+		t.Error("Expected pool a to be active")
+	}
+
+	if states.Get("b") != StateIdle {
+		t.Error("Expected pool b to be idle")
+	}
+
+	// Other pools can be acquired concurrently
+	states.Acquire("b")()
+
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		states.Acquire("a")()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected the second action on pool a to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	<-acquired
+
+	if states.Get("a") != StateIdle {
+		t.Error("Expected pool a to be idle after all actions finished")
+	}
+}
+
+// TestBackoff tests that failing pools are delayed exponentially up to the maximum while other pools are not
+func TestBackoff(t *testing.T) {
+	now := time.Now()
+	b := Backoff{Min: time.Minute, Max: time.Minute * 3, now: func() time.Time { return now }}
+
+	if !b.Ready("a") {
+		t.Fatal("Expected pool a to be ready")
+	}
+
+	for _, expected := range []time.Duration{time.Minute, time.Minute * 2, time.Minute * 3, time.Minute * 3} {
+		if d := b.Fail("a"); d != expected {
+			t.Errorf("Expected a delay of %s, got %s", expected, d)
+		}
+	}
+
+	if b.Ready("a") {
+		t.Error("Expected pool a to be delayed")
+	}
+
+	if !b.Ready("b") {
+		t.Error("Expected pool b to be ready")
+	}
+
+	now = now.Add(time.Minute * 3)
+
+	if !b.Ready("a") {
+		t.Error("Expected pool a to be ready once the delay passed")
+	}
+
+	b.Fail("a")
+	b.Reset("a")
+
+	if !b.Ready("a") {
+		t.Error("Expected pool a to be ready after a reset")
+	}
+
+	if d := b.Fail("a"); d != time.Minute {
+		t.Errorf("Expected the delay to restart at %s, got %s", time.Minute, d)
+	}
+}
@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance"
+)
+
+// WarmTag is the tag of the powered off servers of a warm pool, they are not part of the server pool until started
+const WarmTag = "autoscaler:warm"
+
+// MetaWarm is the status meta key of the number of warm servers
+const MetaWarm = "scaleway_warm"
+
+// DefaultWarmName is the name template of the warm servers of policies without a name
+const DefaultWarmName instance.NameTemplate = "scw-{{random 8}}"
+
+// WarmPool represents the number of powered off servers kept ready to be started on scale up, zero disables the warm pool
+type WarmPool struct {
+	Size int `mapstructure:"warm_pool_size"`
+}
+
+// Decode decodes the warm pool keys from a map of strings
+func (w *WarmPool) Decode(config map[string]string) error {
+	var r WarmPool
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{WeaklyTypedInput: true, Result: &r})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	if r.Size < 0 {
+		return fmt.Errorf("warm_pool_size cannot be negative, got %d", r.Size)
+	}
+
+	*w = r
+
+	return nil
+}
+
+// Warm filters the slice into a subslice of warm servers of the pool, in any of its zones. The hibernated tag wins
+// over the warm tag, servers with both are hibernated.
+func (p *Policy) Warm(servers instance.Servers) (r instance.Servers) {
+	for _, server := range p.members(servers) {
+		if server.HasTag(WarmTag) && !server.HasTag(HibernatedTag) {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// refillWarm refills the warm pool of the policy in the background. Refills hold the pool like scaling actions do,
+// at most one refill per pool is pending at a time. Failed refills are not retried until their backoff passed.
+func (p *Plugin) refillWarm(policy Policy) {
+	key := policy.Key()
+
+	if !p.warmBackoff.Ready(key) {
+		return
+	}
+
+	if _, pending := p.warming.LoadOrStore(key, true); pending {
+		return
+	}
+
+	go func() {
+		defer p.warming.Delete(key)
+
+		release := p.states.Acquire(key)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), policy.Opt.Timeouts.ScaleTimeout())
+		defer cancel()
+
+		err := p.RefillWarm(ctx, &policy)
+		if err != nil {
+			p.logger.Error("Could not refill warm pool", "error", err, "retry_in", p.warmBackoff.Fail(key))
+			return
+		}
+
+		p.warmBackoff.Reset(key)
+	}()
+}
+
+// RefillWarm provisions the missing warm servers of the pool, or deletes the extra ones if the size was reduced.
+// Warm servers are spread over the policy zones like the servers of the pool are.
+func (p *Plugin) RefillWarm(ctx context.Context, policy *Policy) error {
+	servers, err := p.api().ListServersAll(ctx, policy.Blueprint, policy.Zones...)
+	if err != nil {
+		return err
+	}
+
+	warm := policy.Warm(servers)
+
+	switch n := policy.WarmPool.Size - len(warm); {
+	case n > 0:
+		return p.provisionWarm(ctx, policy, policy.members(servers), warm, n)
+	case n < 0:
+		return p.trimWarm(ctx, policy, warm, -n)
+	}
+
+	return nil
+}
+
+// provisionWarm provisions `n` warm servers, `servers` are the existing servers whose names cannot be reused.
+// Warm servers of policies without a name are named from DefaultWarmName, they are provisioned concurrently and the
+// names the SDK generates are not safe for concurrent use.
+func (p *Plugin) provisionWarm(ctx context.Context, policy *Policy, servers, warm instance.Servers, n int) error {
+	name := policy.Opt.Name
+	if len(name) == 0 {
+		name = DefaultWarmName
+	}
+
+	var namer *instance.Namer
+	if name.IsTemplate() {
+		namer = instance.NewNamer(name, servers)
+	}
+
+	spread := policy.Zones.Spread(warm, n)
+	types := p.commercialTypes(ctx, policy, spread)
+
+	results := &Results{}
+
+	ch := make(chan placement)
+	wg := p.doAsyncScale(n, policy.Limits.Creates(), p.doProvisionWarm(ctx, ch, results, policy, namer))
+
+	for i, zone := range spread {
+		ch <- placement{index: i, zone: zone, types: types[zone]}
+	}
+
+	close(ch)
+	wg.Wait()
+
+	return results.Err("warm")
+}
+
+// doProvisionWarm returns a function that can be used to asynchronously provision warm servers, the namer can be nil
+func (p *Plugin) doProvisionWarm(ctx context.Context, ch chan placement, results *Results, policy *Policy, namer *instance.Namer) func() {
+	return func() {
+		for pl := range ch {
+			server := policy.Blueprint
+			server.Zone = pl.zone
+			server.Tags = append(append([]string{}, policy.Blueprint.Tags...), WarmTag)
+
+			if namer != nil {
+				name, err := namer.Next(pl.zone)
+				if err != nil {
+					results.Add(fmt.Sprintf("server #%d", pl.index), err)
+					continue
+				}
+
+				server.Name = name
+			}
+
+			server, err := p.api().ProvisionServerWithTypes(ctx, server, pl.types, &policy.Opt)
+			if err != nil {
+				p.logger.Error("Could not provision warm Scaleway server", "zone", pl.zone, "error", err)
+				emitFailed(policy, pl.zone, "provision")
+				results.Add(fmt.Sprintf("server #%d", pl.index), err)
+				continue
+			}
+
+			emitProvisioned(policy, server.Zone)
+			results.Add(server.ID, nil)
+		}
+	}
+}
+
+// trimWarm deletes `n` warm servers, starting with the most over-represented zones. Warm servers are always deleted,
+// hibernating them would keep them in the warm pool.
+func (p *Plugin) trimWarm(ctx context.Context, policy *Policy, warm instance.Servers, n int) error {
+	trim := policy.Zones.Trim(warm, n)
+
+	var selected instance.Servers
+	for _, server := range warm {
+		if trim[server.Zone] > 0 {
+			trim[server.Zone]--
+			selected = append(selected, server)
+		}
+	}
+
+	results := &Results{}
+
+	ch := make(chan *instance.Server)
+	wg := p.doAsyncScale(len(selected), policy.Limits.Deletes(), p.doDelete(ctx, ch, results, policy, time.Time{}))
+
+	for _, server := range selected {
+		ch <- server
+	}
+
+	close(ch)
+	wg.Wait()
+
+	return results.Err("warm")
+}
@@ -0,0 +1,299 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad-autoscaler/sdk"
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+)
+
+// AddWarm registers a powered off warm Scaleway server in the pool
+func (h *Harness) AddWarm(name string) *instance.Server {
+	return h.Scaleway.AddServer(&instance.Server{Name: name, State: instance.ServerStateStopped,
+		CommercialType: h.Policy["commercial_type"], Tags: []string{"nomad", "client", "autoscaler", WarmTag}})
+}
+
+// warmServers returns the warm servers known to the fake Scaleway API
+func (h *Harness) warmServers() (r []*instance.Server) {
+	for _, server := range h.Scaleway.Servers() {
+		if isWarm(server) {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// WaitWarm waits for the pending warm pool refill of the policy to finish
+func (h *Harness) WaitWarm(t *testing.T) {
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for _, pending := h.Plugin.warming.Load(policy.Key()); pending; _, pending = h.Plugin.warming.Load(policy.Key()) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the warm pool refill")
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// isWarm returns whether the server has the warm tag
+func isWarm(server *instance.Server) bool {
+	for _, tag := range server.Tags {
+		if tag == WarmTag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TestStatusWarm tests that warm servers are reported but not counted
+func TestStatusWarm(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+	h.AddWarm("warm-0")
+
+	h.Policy["warm_pool_size"] = "1"
+
+	status, err := h.Plugin.Status(h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Ready || status.Count != 1 || status.Meta[MetaWarm] != "1" {
+		t.Errorf("Expected a ready pool of 1 server and 1 warm server, got ready=%t count=%d meta=%v",
+			status.Ready, status.Count, status.Meta)
+	}
+}
+
+// TestScaleUpWarm tests that warm servers are started before new servers are created and that the warm pool is
+// refilled afterwards
+func TestScaleUpWarm(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	warm := []*instance.Server{h.AddWarm("warm-0"), h.AddWarm("warm-1")}
+
+	h.Policy["warm_pool_size"] = "2"
+
+	err := h.Plugin.Scale(sdk.ScalingAction{Count: 4, Direction: sdk.ScaleDirectionUp}, h.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, server := range warm {
+		started := h.Scaleway.GetServer(server.ID)
+		if started.State != instance.ServerStateRunning {
+			t.Errorf("Expected warm server %s to be running, got %s", server.ID, started.State)
+		}
+
+		if isWarm(started) {
+			t.Errorf("Expected the warm tag of server %s to be removed", server.ID)
+		}
+	}
+
+	// Two warm servers were started and a single new server was created, the refill runs in the background
+	h.WaitWarm(t)
+
+	refilled := h.warmServers()
+	if len(refilled) != 2 {
+		t.Fatalf("Expected the warm pool to be refilled to 2 servers, got %d", len(refilled))
+	}
+
+	for _, server := range refilled {
+		if server.State != instance.ServerStateStopped {
+			t.Errorf("Expected refilled warm server %s to be stopped, got %s", server.ID, server.State)
+		}
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 6 {
+		t.Errorf("Expected 4 pool servers and 2 warm servers, got %d servers", n)
+	}
+}
+
+// TestScaleUpWarmFailure tests that a new server is created instead of a warm server that fails to start, the warm
+// server is kept
+func TestScaleUpWarmFailure(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	broken := h.AddWarm("warm-0")
+
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := h.Plugin.api().ListServersAll(context.Background(), policy.Blueprint, policy.Zones...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the power on of the warm server fails
+	h.Scaleway.Inject(instancetest.Fault{Method: http.MethodPost, Path: "servers/*/action", Count: 1,
+		Err: &instancetest.Error{Status: http.StatusConflict, Type: "conflict", Message: "boom"}})
+
+	err = h.Plugin.ScaleUp(context.Background(), &policy, policy.Pool(servers), policy.Resumable(servers), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kept := h.Scaleway.GetServer(broken.ID); kept == nil || !isWarm(kept) {
+		t.Error("Expected the warm server that failed to start to be kept in the warm pool")
+	}
+
+	servers, err = h.Plugin.api().ListServersAll(context.Background(), policy.Blueprint, policy.Zones...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(policy.Pool(servers)); n != 2 {
+		t.Errorf("Expected 2 pool servers, got %d", n)
+	}
+}
+
+// TestRefillWarm tests provisioning missing warm servers and deleting extra ones
+func TestRefillWarm(t *testing.T) {
+	h := NewHarness(t)
+	h.Policy["name"] = "nomad-client-{{index}}"
+	h.AddClient("nomad-client-0")
+
+	h.Policy["warm_pool_size"] = "2"
+
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	err := h.Plugin.RefillWarm(context.Background(), &policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warm := h.warmServers()
+	if len(warm) != 2 {
+		t.Fatalf("Expected 2 warm servers, got %d", len(warm))
+	}
+
+	for _, server := range warm {
+		if server.State != instance.ServerStateStopped {
+			t.Errorf("Expected warm server %s to be stopped, got %s", server.ID, server.State)
+		}
+
+		if server.Name == "nomad-client-0" {
+			t.Errorf("Expected warm servers not to reuse the names of the pool")
+		}
+
+		if data := h.Scaleway.UserData(server.ID); data["cloud-init"] != "#cloud-config" {
+			t.Errorf("Expected warm server %s to have user data, got %v", server.ID, data)
+		}
+	}
+
+	// Reducing the size deletes the extra warm servers
+	policy.WarmPool.Size = 0
+
+	err = h.Plugin.RefillWarm(context.Background(), &policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.warmServers()); n != 0 {
+		t.Errorf("Expected no warm servers, got %d", n)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 1 {
+		t.Errorf("Expected the pool server to be kept, got %d servers", n)
+	}
+}
+
+// TestStatusWarmBackoff tests that a failed warm pool refill is not retried on every status poll
+func TestStatusWarmBackoff(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	h.Policy["warm_pool_size"] = "1"
+
+	h.Scaleway.Inject(instancetest.Fault{Method: http.MethodPost, Path: "servers",
+		Err: &instancetest.Error{Status: http.StatusForbidden, Type: "quotas_exceeded", Message: "boom"}})
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.Plugin.Status(h.Policy); err != nil {
+			t.Fatal(err)
+		}
+
+		h.WaitWarm(t)
+	}
+
+	if n := h.Scaleway.Requests(http.MethodPost, "servers"); n != 1 {
+		t.Errorf("Expected a single attempt to provision the warm server, got %d", n)
+	}
+}
+
+// TestRefillWarmHibernate tests that extra warm servers are deleted rather than hibernated in a hibernating pool
+func TestRefillWarmHibernate(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+	h.AddWarm("warm-0")
+	h.AddWarm("warm-1")
+
+	h.Policy["scale_in_mode"] = ScaleInPoweroff
+	h.Policy["warm_pool_size"] = "1"
+
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	err := h.Plugin.RefillWarm(context.Background(), &policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.warmServers()); n != 1 {
+		t.Errorf("Expected 1 warm server, got %d", n)
+	}
+
+	if n := len(h.Scaleway.Servers()); n != 2 {
+		t.Errorf("Expected the extra warm server to be deleted, got %d servers", n)
+	}
+}
+
+// TestRefillWarmDefaultName tests that warm servers of policies without a name are named from the default template
+func TestRefillWarmDefaultName(t *testing.T) {
+	h := NewHarness(t)
+	h.AddClient("client-0")
+
+	delete(h.Policy, "name")
+	h.Policy["warm_pool_size"] = "2"
+
+	var policy Policy
+	if err := policy.Decode(h.Policy); err != nil {
+		t.Fatal(err)
+	}
+
+	err := h.Plugin.RefillWarm(context.Background(), &policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warm := h.warmServers()
+	if len(warm) != 2 {
+		t.Fatalf("Expected 2 warm servers, got %d", len(warm))
+	}
+
+	for _, server := range warm {
+		if !regexp.MustCompile(`^scw-[a-z0-9]{8}$`).MatchString(server.Name) {
+			t.Errorf("Expected a name rendered from %s, got %s", DefaultWarmName, server.Name)
+		}
+	}
+}
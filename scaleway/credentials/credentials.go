@@ -0,0 +1,229 @@
+// Package credentials provides the Scaleway API credentials of the plugin from pluggable sources
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// A set of credential providers
+const (
+	// ProviderStatic uses the credentials of the plugin configuration
+	ProviderStatic = "static"
+
+	// ProviderEnv uses the credentials of the `SCW_*` environment variables
+	ProviderEnv = "env"
+
+	// ProviderProfile uses the credentials of a Scaleway CLI configuration profile
+	ProviderProfile = "profile"
+
+	// ProviderFile uses the credentials of a JSON file, e.g. written by secret tooling
+	ProviderFile = "file"
+)
+
+// DefaultRefreshInterval is the default interval at which the credentials of the profile and file providers are read
+const DefaultRefreshInterval = time.Minute
+
+// Redacted replaces secret values in logs
+const Redacted = "<redacted>"
+
+// Config represents the credential provider settings
+type Config struct {
+	Provider        string        `mapstructure:"credentials_provider"`
+	File            string        `mapstructure:"credentials_file"`
+	Profile         string        `mapstructure:"credentials_profile"`
+	RefreshInterval time.Duration `mapstructure:"credentials_refresh_interval"`
+}
+
+// DefaultConfig returns the default credential provider settings
+func DefaultConfig() Config {
+	return Config{
+		Provider:        ProviderStatic,
+		RefreshInterval: DefaultRefreshInterval,
+	}
+}
+
+// Validate returns an error if the settings are invalid
+func (c Config) Validate() error {
+	switch c.Provider {
+	case ProviderStatic, ProviderEnv, ProviderProfile:
+	case ProviderFile:
+		if len(c.File) == 0 {
+			return fmt.Errorf("credentials_provider %s requires a credentials_file", ProviderFile)
+		}
+	default:
+		return fmt.Errorf("invalid credentials_provider '%s', expected %s, %s, %s or %s", c.Provider, ProviderStatic,
+			ProviderEnv, ProviderProfile, ProviderFile)
+	}
+
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("credentials_refresh_interval cannot be negative, got %s", c.RefreshInterval)
+	}
+
+	return nil
+}
+
+// Rotates returns whether the credentials of the provider can change while the plugin runs
+func (c Config) Rotates() bool {
+	return (c.Provider == ProviderProfile || c.Provider == ProviderFile) && c.RefreshInterval > 0
+}
+
+// Credentials represents a set of Scaleway API credentials, empty values are left to the environment
+type Credentials struct {
+	AccessKey      string `json:"access_key"`
+	SecretKey      string `json:"secret_key"`
+	ProjectID      string `json:"project_id"`
+	OrganizationID string `json:"organization_id"`
+}
+
+// ClientOptions returns the Scaleway client options applying the credentials
+func (c Credentials) ClientOptions() (opts []scw.ClientOption) {
+	if len(c.AccessKey) > 0 || len(c.SecretKey) > 0 {
+		opts = append(opts, scw.WithAuth(c.AccessKey, c.SecretKey))
+	}
+
+	if len(c.ProjectID) > 0 {
+		opts = append(opts, scw.WithDefaultProjectID(c.ProjectID))
+	}
+
+	if len(c.OrganizationID) > 0 {
+		opts = append(opts, scw.WithDefaultOrganizationID(c.OrganizationID))
+	}
+
+	return opts
+}
+
+// String returns the credentials with the secret key redacted
+func (c Credentials) String() string {
+	secret := ""
+	if len(c.SecretKey) > 0 {
+		secret = Redacted
+	}
+
+	return fmt.Sprintf("access_key=%s secret_key=%s project_id=%s organization_id=%s", c.AccessKey, secret,
+		c.ProjectID, c.OrganizationID)
+}
+
+// GoString returns the credentials with the secret key redacted, it is used by the `%#v` format
+func (c Credentials) GoString() string {
+	return c.String()
+}
+
+// Provider provides the current Scaleway API credentials
+type Provider interface {
+	Credentials() (Credentials, error)
+}
+
+// NewProvider returns the provider of the settings, the static provider returns the given credentials
+func NewProvider(config Config, static Credentials) (Provider, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Provider {
+	case ProviderEnv:
+		return Env{}, nil
+	case ProviderProfile:
+		return Profile{Path: config.File, Name: config.Profile}, nil
+	case ProviderFile:
+		return File{Path: config.File}, nil
+	}
+
+	return Static(static), nil
+}
+
+// Static provides fixed credentials
+type Static Credentials
+
+// Credentials returns the fixed credentials
+func (s Static) Credentials() (Credentials, error) {
+	return Credentials(s), nil
+}
+
+// Env provides the credentials of the `SCW_ACCESS_KEY`, `SCW_SECRET_KEY`, `SCW_DEFAULT_PROJECT_ID` and
+// `SCW_DEFAULT_ORGANIZATION_ID` environment variables
+type Env struct{}
+
+// Credentials returns the credentials of the environment
+func (Env) Credentials() (Credentials, error) {
+	return fromProfile(scw.LoadEnvProfile()), nil
+}
+
+// Profile provides the credentials of a profile of the Scaleway CLI configuration file, the default path and
+// the active profile are used if not set
+type Profile struct {
+	Path string
+	Name string
+}
+
+// Credentials reads the credentials of the profile
+func (p Profile) Credentials() (Credentials, error) {
+	path := p.Path
+	if len(path) == 0 {
+		path = scw.GetConfigPath()
+	}
+
+	config, err := scw.LoadConfigFromPath(path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var profile *scw.Profile
+
+	if len(p.Name) > 0 {
+		profile, err = config.GetProfile(p.Name)
+	} else {
+		profile, err = config.GetActiveProfile()
+	}
+
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return fromProfile(profile), nil
+}
+
+// File provides the credentials of a JSON file, e.g. `{"access_key": "SCW...", "secret_key": "..."}`
+type File struct {
+	Path string
+}
+
+// Credentials reads the credentials of the file
+func (f File) Credentials() (Credentials, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var c Credentials
+
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("could not decode credentials file %s: %w", f.Path, err)
+	}
+
+	return c, nil
+}
+
+// fromProfile returns the credentials of a Scaleway configuration profile
+func fromProfile(p *scw.Profile) Credentials {
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+
+		return *s
+	}
+
+	return Credentials{
+		AccessKey:      value(p.AccessKey),
+		SecretKey:      value(p.SecretKey),
+		ProjectID:      value(p.DefaultProjectID),
+		OrganizationID: value(p.DefaultOrganizationID),
+	}
+}
@@ -0,0 +1,171 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A set of test credentials
+const (
+	testAccessKey = "SCWXXXXXXXXXXXXXXXXX"
+	testSecretKey = "11111111-1111-1111-1111-111111111111"
+	testProjectID = "22222222-2222-2222-2222-222222222222"
+)
+
+// writeFile writes the data to a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// TestConfigValidate tests the validation of the provider settings
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		config Config
+		valid  bool
+	}{
+		{DefaultConfig(), true},
+		{Config{Provider: ProviderEnv}, true},
+		{Config{Provider: ProviderProfile}, true},
+		{Config{Provider: ProviderFile, File: "/etc/scaleway.json"}, true},
+		{Config{Provider: ProviderFile}, false},
+		{Config{Provider: "vault"}, false},
+		{Config{Provider: ProviderStatic, RefreshInterval: -1}, false},
+	}
+
+	for _, test := range tests {
+		err := test.config.Validate()
+		if (err == nil) != test.valid {
+			t.Errorf("Expected %+v to be valid=%t, got %v", test.config, test.valid, err)
+		}
+	}
+}
+
+// TestNewProvider tests that the provider of the settings is returned
+func TestNewProvider(t *testing.T) {
+	static := Credentials{AccessKey: testAccessKey, SecretKey: testSecretKey}
+
+	provider, err := NewProvider(DefaultConfig(), static)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := provider.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c != static {
+		t.Errorf("Expected the static credentials, got %s", c)
+	}
+
+	_, err = NewProvider(Config{Provider: "vault"}, static)
+	if err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
+
+// TestEnv tests reading the credentials of the environment
+func TestEnv(t *testing.T) {
+	t.Setenv("SCW_ACCESS_KEY", testAccessKey)
+	t.Setenv("SCW_SECRET_KEY", testSecretKey)
+	t.Setenv("SCW_DEFAULT_PROJECT_ID", testProjectID)
+
+	c, err := Env{}.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Credentials{AccessKey: testAccessKey, SecretKey: testSecretKey, ProjectID: testProjectID}
+	if c != expected {
+		t.Errorf("Expected %s, got %s", expected, c)
+	}
+}
+
+// TestProfile tests reading the credentials of a Scaleway CLI configuration profile
+func TestProfile(t *testing.T) {
+	t.Setenv("SCW_PROFILE", "")
+
+	path := writeFile(t, "config.yaml", `access_key: SCWDEFAULTXXXXXXXXXX
+secret_key: 33333333-3333-3333-3333-333333333333
+profiles:
+  autoscaler:
+    access_key: `+testAccessKey+`
+    secret_key: `+testSecretKey+`
+    default_project_id: `+testProjectID+`
+`)
+
+	c, err := Profile{Path: path, Name: "autoscaler"}.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Credentials{AccessKey: testAccessKey, SecretKey: testSecretKey, ProjectID: testProjectID}
+	if c != expected {
+		t.Errorf("Expected %s, got %s", expected, c)
+	}
+
+	// The default profile is active if no profile is given
+	c, err = Profile{Path: path}.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.AccessKey != "SCWDEFAULTXXXXXXXXXX" {
+		t.Errorf("Expected the credentials of the default profile, got %s", c)
+	}
+
+	_, err = Profile{Path: path, Name: "unknown"}.Credentials()
+	if err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
+
+// TestFile tests reading the credentials of a JSON file
+func TestFile(t *testing.T) {
+	path := writeFile(t, "credentials.json", fmt.Sprintf(`{"access_key": "%s", "secret_key": "%s"}`, testAccessKey,
+		testSecretKey))
+
+	c, err := File{Path: path}.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Credentials{AccessKey: testAccessKey, SecretKey: testSecretKey}
+	if c != expected {
+		t.Errorf("Expected %s, got %s", expected, c)
+	}
+
+	_, err = File{Path: writeFile(t, "invalid.json", "{")}.Credentials()
+	if err == nil {
+		t.Error("Expected an error for an invalid file")
+	}
+
+	_, err = File{Path: filepath.Join(t.TempDir(), "missing.json")}.Credentials()
+	if err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+// TestCredentialsString tests that the secret key is redacted when formatted
+func TestCredentialsString(t *testing.T) {
+	c := Credentials{AccessKey: testAccessKey, SecretKey: testSecretKey}
+
+	for _, s := range []string{c.String(), fmt.Sprintf("%v", c), fmt.Sprintf("%+v", c), fmt.Sprintf("%#v", c)} {
+		if strings.Contains(s, testSecretKey) {
+			t.Errorf("Expected the secret key to be redacted, got %s", s)
+		}
+
+		if !strings.Contains(s, testAccessKey) {
+			t.Errorf("Expected the access key to be kept, got %s", s)
+		}
+	}
+}
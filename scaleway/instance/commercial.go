@@ -0,0 +1,85 @@
+package instance
+
+import (
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/karelorigin/nomad-scaleway-target/types"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+)
+
+// CommercialTypes represents an ordered list of acceptable commercial types, the first type being preferred
+type CommercialTypes []string
+
+// Decode decodes the `commercial_type` list from a map of strings
+func (c *CommercialTypes) Decode(config map[string]string) error {
+	var shadow struct {
+		CommercialType types.SliceString `mapstructure:"commercial_type"`
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: mapstructure.TextUnmarshallerHookFunc(),
+		Result: &shadow})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	r := CommercialTypes{}
+
+	for _, t := range shadow.CommercialType {
+		if t = strings.TrimSpace(t); len(t) > 0 && !r.Contains(t) {
+			r = append(r, t)
+		}
+	}
+
+	*c = r
+
+	return nil
+}
+
+// Contains returns whether the given commercial type is part of the list
+func (c CommercialTypes) Contains(commercialType string) bool {
+	for _, t := range c {
+		if t == commercialType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter filters the slice into a subslice of servers with one of the commercial types, an empty list matches all
+func (c CommercialTypes) Filter(servers Servers) (r Servers) {
+	if len(c) == 0 {
+		return servers
+	}
+
+	for _, server := range servers {
+		if c.Contains(server.CommercialType) {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// Rank returns the commercial types with the types in shortage moved to the end, the order is kept otherwise.
+// Types missing from the availability map are considered available.
+func (c CommercialTypes) Rank(availability map[string]instance.ServerTypesAvailability) CommercialTypes {
+	var available, shortage CommercialTypes
+
+	for _, t := range c {
+		if availability[t] == instance.ServerTypesAvailabilityShortage {
+			shortage = append(shortage, t)
+		} else {
+			available = append(available, t)
+		}
+	}
+
+	return append(available, shortage...)
+}
@@ -0,0 +1,45 @@
+package instance
+
+import (
+	"testing"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+)
+
+// TestCommercialTypesDecode tests decoding the commercial type list
+func TestCommercialTypesDecode(t *testing.T) {
+	var types CommercialTypes
+
+	err := types.Decode(map[string]string{"commercial_type": "PRO2-S, DEV1-L,,GP1-XS,PRO2-S"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := CommercialTypes{"PRO2-S", "DEV1-L", "GP1-XS"}
+	if len(types) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, types)
+	}
+
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, types)
+		}
+	}
+}
+
+// TestCommercialTypesRank tests moving types in shortage to the end of the list
+func TestCommercialTypesRank(t *testing.T) {
+	types := CommercialTypes{"PRO2-S", "DEV1-L", "GP1-XS"}
+
+	ranked := types.Rank(map[string]instance.ServerTypesAvailability{
+		"PRO2-S": instance.ServerTypesAvailabilityShortage,
+		"DEV1-L": instance.ServerTypesAvailabilityScarce,
+	})
+
+	expected := CommercialTypes{"DEV1-L", "GP1-XS", "PRO2-S"}
+	for i := range expected {
+		if ranked[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, ranked)
+		}
+	}
+}
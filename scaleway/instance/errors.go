@@ -0,0 +1,67 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// CreateError represents a server that was created but failed to bootstrap
+type CreateError struct {
+	ServerID   string
+	Err        error
+	CleanupErr error
+}
+
+// Error satisfies the error interface
+func (e *CreateError) Error() string {
+	if e.CleanupErr != nil {
+		return fmt.Sprintf("could not bootstrap server %s: %s, cleanup failed: %s", e.ServerID, e.Err, e.CleanupErr)
+	}
+
+	return fmt.Sprintf("could not bootstrap server %s: %s, server was removed", e.ServerID, e.Err)
+}
+
+// Unwrap returns the error that caused the server to be rolled back
+func (e *CreateError) Unwrap() error {
+	return e.Err
+}
+
+// StartError represents a stopped server that failed to power on, it is kept stopped with its tags restored
+type StartError struct {
+	ServerID   string
+	Err        error
+	RestoreErr error
+}
+
+// Error satisfies the error interface
+func (e *StartError) Error() string {
+	if e.RestoreErr != nil {
+		return fmt.Sprintf("could not start server %s: %s, restoring its tags failed: %s", e.ServerID, e.Err,
+			e.RestoreErr)
+	}
+
+	return fmt.Sprintf("could not start server %s: %s, server was kept stopped", e.ServerID, e.Err)
+}
+
+// Unwrap returns the error that kept the server from starting
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// IsNotFound returns whether the error reports a resource that does not exist
+func IsNotFound(err error) bool {
+	var notFound *scw.ResourceNotFoundError
+	return errors.As(err, &notFound)
+}
+
+// IsCapacityError returns whether the error reports a lack of capacity, i.e. a resource out of stock or a quota exceeded
+func IsCapacityError(err error) bool {
+	var (
+		outOfStock *scw.OutOfStockError
+		quotas     *scw.QuotasExceededError
+	)
+
+	return errors.As(err, &outOfStock) || errors.As(err, &quotas)
+}
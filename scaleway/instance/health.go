@@ -0,0 +1,74 @@
+package instance
+
+import (
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+)
+
+// Health represents the health of a server derived from its state
+type Health int
+
+// A set of server health classes
+const (
+	// HealthRunning servers are up
+	HealthRunning Health = iota
+
+	// HealthTransitional servers are on their way to another state, e.g. starting or stopping
+	HealthTransitional
+
+	// HealthStuck servers are locked or have not been running for longer than the stuck timeout
+	HealthStuck
+)
+
+// String satisfies the fmt.Stringer interface
+func (h Health) String() string {
+	switch h {
+	case HealthRunning:
+		return "running"
+	case HealthTransitional:
+		return "transitional"
+	case HealthStuck:
+		return "stuck"
+	}
+
+	return "unknown"
+}
+
+// Health classifies the server, servers that are not running are stuck once they were last modified more than
+// `timeout` ago. Locked servers are always stuck.
+func (s *Server) Health(now time.Time, timeout time.Duration) Health {
+	switch s.State {
+	case instance.ServerStateRunning:
+		return HealthRunning
+	case instance.ServerStateLocked:
+		return HealthStuck
+	}
+
+	if since := s.LastModified(); since != nil && now.Sub(*since) > timeout {
+		return HealthStuck
+	}
+
+	return HealthTransitional
+}
+
+// LastModified returns the last modification date of the server, or the creation date if unknown
+func (s *Server) LastModified() *time.Time {
+	if s.ModificationDate != nil {
+		return s.ModificationDate
+	}
+
+	return s.CreationDate
+}
+
+// Classify groups the servers by their health, see `Server.Health`
+func (s Servers) Classify(now time.Time, timeout time.Duration) map[Health]Servers {
+	r := make(map[Health]Servers)
+
+	for _, server := range s {
+		h := server.Health(now, timeout)
+		r[h] = append(r[h], server)
+	}
+
+	return r
+}
@@ -0,0 +1,48 @@
+package instance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+)
+
+// TestClassify tests classifying servers by their health
+func TestClassify(t *testing.T) {
+	var (
+		now    = time.Now()
+		recent = now.Add(-time.Minute)
+		old    = now.Add(-time.Hour)
+	)
+
+	servers := Servers{
+		{ID: "running", State: instance.ServerStateRunning, ModificationDate: &old},
+		{ID: "starting", State: instance.ServerStateStarting, ModificationDate: &recent},
+		{ID: "stopping", State: instance.ServerStateStopping, ModificationDate: &old},
+		{ID: "stopped", State: instance.ServerStateStopped, CreationDate: &old},
+		{ID: "locked", State: instance.ServerStateLocked, ModificationDate: &recent},
+	}
+
+	classes := servers.Classify(now, time.Minute*10)
+
+	expected := map[Health][]string{
+		HealthRunning:      {"running"},
+		HealthTransitional: {"starting"},
+		HealthStuck:        {"stopping", "stopped", "locked"},
+	}
+
+	for health, ids := range expected {
+		got := classes[health].IDs()
+		if len(got) != len(ids) {
+			t.Errorf("Expected %s servers %v, got %v", health, ids, got)
+			continue
+		}
+
+		for i := range ids {
+			if got[i] != ids[i] {
+				t.Errorf("Expected %s servers %v, got %v", health, ids, got)
+				break
+			}
+		}
+	}
+}
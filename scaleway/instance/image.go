@@ -0,0 +1,217 @@
+package instance
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/api/marketplace/v2"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// DefaultImageCacheTTL is the default duration resolved images are cached for
+const DefaultImageCacheTTL = time.Minute * 5
+
+// A set of image reference prefixes selecting private images of the project
+const (
+	// ImageNamePrefix selects the newest private image whose name starts with the rest of the reference
+	ImageNamePrefix = "name:"
+
+	// ImageTagPrefix selects the newest private image with all of the comma-separated tags of the rest of the reference
+	ImageTagPrefix = "tag:"
+)
+
+// uuidPattern matches image IDs, references that do not match are resolved
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Images resolves image references into zone-specific image IDs, results are cached for the TTL.
+// A reference is either an image ID, a marketplace label (e.g. `ubuntu_jammy`) or a private image selector,
+// see ImageNamePrefix and ImageTagPrefix.
+type Images struct {
+	TTL time.Duration
+
+	client *scw.Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	images map[string]cachedImage
+	arches map[scw.Zone]map[string]instance.Arch
+}
+
+// cachedImage holds a resolved image ID and when it was resolved
+type cachedImage struct {
+	id       string
+	resolved time.Time
+}
+
+// NewImages returns a new image resolver, a zero TTL uses the default
+func NewImages(client *scw.Client, ttl time.Duration) *Images {
+	if ttl <= 0 {
+		ttl = DefaultImageCacheTTL
+	}
+
+	return &Images{
+		TTL:    ttl,
+		client: client,
+		now:    time.Now,
+		images: make(map[string]cachedImage),
+		arches: make(map[scw.Zone]map[string]instance.Arch),
+	}
+}
+
+// Resolve returns the ID of the image the reference points to in the given zone, compatible with the commercial type.
+// Root volumes of type `sbs_volume` use block storage images of the marketplace, other types use local images.
+func (i *Images) Resolve(ctx context.Context, ref string, zone scw.Zone, commercialType string, rootVolumeType string) (string, error) {
+	if uuidPattern.MatchString(ref) {
+		return ref, nil
+	}
+
+	key := strings.Join([]string{ref, string(zone), commercialType, rootVolumeType}, "|")
+
+	i.mu.Lock()
+	cached, ok := i.images[key]
+	i.mu.Unlock()
+
+	if ok && i.now().Sub(cached.resolved) < i.TTL {
+		return cached.id, nil
+	}
+
+	var (
+		id  string
+		err error
+	)
+
+	switch {
+	case strings.HasPrefix(ref, ImageNamePrefix), strings.HasPrefix(ref, ImageTagPrefix):
+		id, err = i.resolvePrivate(ctx, ref, zone, commercialType)
+	default:
+		id, err = i.resolveMarketplace(ctx, ref, zone, commercialType, rootVolumeType)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not resolve image '%s' in %s for %s: %w", ref, zone, commercialType, err)
+	}
+
+	i.mu.Lock()
+	i.images[key] = cachedImage{id: id, resolved: i.now()}
+	i.mu.Unlock()
+
+	return id, nil
+}
+
+// resolveMarketplace returns the local image of the marketplace label in the zone that is compatible with the
+// commercial type
+func (i *Images) resolveMarketplace(ctx context.Context, label string, zone scw.Zone, commercialType string, rootVolumeType string) (string, error) {
+	imageType := marketplace.LocalImageTypeInstanceLocal
+	if rootVolumeType == string(instance.VolumeVolumeTypeSbsVolume) {
+		imageType = marketplace.LocalImageTypeInstanceSbs
+	}
+
+	image, err := marketplace.NewAPI(i.client).GetLocalImageByLabel(&marketplace.GetLocalImageByLabelRequest{
+		ImageLabel: label, Zone: zone, CommercialType: commercialType, Type: imageType}, scw.WithAllPages(), scw.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	return image.ID, nil
+}
+
+// resolvePrivate returns the newest available private image of the project matching the selector, with the
+// architecture of the commercial type
+func (i *Images) resolvePrivate(ctx context.Context, selector string, zone scw.Zone, commercialType string) (string, error) {
+	arch, err := i.arch(ctx, zone, commercialType)
+	if err != nil {
+		return "", err
+	}
+
+	req := &instance.ListImagesRequest{Zone: zone, Public: scw.BoolPtr(false), Arch: scw.StringPtr(string(arch))}
+
+	if project, ok := i.client.GetDefaultProjectID(); ok {
+		req.Project = &project
+	}
+
+	prefix := strings.TrimPrefix(selector, ImageNamePrefix)
+	if strings.HasPrefix(selector, ImageTagPrefix) {
+		prefix, req.Tags = "", scw.StringPtr(strings.TrimPrefix(selector, ImageTagPrefix))
+	}
+
+	resp, err := instance.NewAPI(i.client).ListImages(req, scw.WithAllPages(), scw.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	var newest *instance.Image
+
+	for _, image := range resp.Images {
+		if image.State != instance.ImageStateAvailable || image.Arch != arch || !strings.HasPrefix(image.Name, prefix) {
+			continue
+		}
+
+		if newest == nil || (image.CreationDate != nil && newest.CreationDate != nil && image.CreationDate.After(*newest.CreationDate)) {
+			newest = image
+		}
+	}
+
+	if newest == nil {
+		return "", fmt.Errorf("no available %s image matches", arch)
+	}
+
+	return newest.ID, nil
+}
+
+// arch returns the architecture of the commercial type in the zone, the server types of a zone are listed once
+func (i *Images) arch(ctx context.Context, zone scw.Zone, commercialType string) (instance.Arch, error) {
+	i.mu.Lock()
+	arches, ok := i.arches[zone]
+	i.mu.Unlock()
+
+	if !ok {
+		resp, err := instance.NewAPI(i.client).ListServersTypes(&instance.ListServersTypesRequest{Zone: zone},
+			scw.WithAllPages(), scw.WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+
+		arches = make(map[string]instance.Arch, len(resp.Servers))
+		for name, serverType := range resp.Servers {
+			arches[name] = serverType.Arch
+		}
+
+		i.mu.Lock()
+		i.arches[zone] = arches
+		i.mu.Unlock()
+	}
+
+	arch, ok := arches[commercialType]
+	if !ok {
+		return "", fmt.Errorf("unknown commercial type %s", commercialType)
+	}
+
+	return arch, nil
+}
+
+// resolveImage resolves the image reference of the blueprint into an image ID of its zone and commercial type,
+// the options can be nil
+func (s *ServerOpt) resolveImage(ctx context.Context, blueprint *Server) error {
+	if s == nil || s.Images == nil || blueprint.Image == nil {
+		return nil
+	}
+
+	var rootVolumeType string
+	if root, ok := blueprint.Volumes["0"]; ok {
+		rootVolumeType = string(root.VolumeType)
+	}
+
+	id, err := s.Images.Resolve(ctx, blueprint.Image.ID, blueprint.Zone, blueprint.CommercialType, rootVolumeType)
+	if err != nil {
+		return err
+	}
+
+	blueprint.Image = &instance.Image{ID: id}
+
+	return nil
+}
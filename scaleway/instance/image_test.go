@@ -0,0 +1,231 @@
+package instance
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/api/marketplace/v2"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// NewTestImages returns a new image resolver backed by a fake Scaleway API
+func NewTestImages(t *testing.T) (*Images, *instancetest.API) {
+	fake := instancetest.NewAPI()
+	t.Cleanup(fake.Close)
+
+	client, err := fake.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewImages(client, 0), fake
+}
+
+// TestImagesResolveID tests that image IDs are used as is
+func TestImagesResolveID(t *testing.T) {
+	images, fake := NewTestImages(t)
+
+	id, err := images.Resolve(context.Background(), "0d1cf4a3-aae9-4294-9fd9-fefffb297615", instancetest.DefaultZone,
+		"DEV1-S", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != "0d1cf4a3-aae9-4294-9fd9-fefffb297615" {
+		t.Errorf("Expected the image ID to be kept, got %s", id)
+	}
+
+	if n := fake.Requests(http.MethodGet, "*"); n != 0 {
+		t.Errorf("Expected no requests, got %d", n)
+	}
+}
+
+// TestImagesResolveMarketplace tests resolving marketplace labels per zone, commercial type and root volume type
+func TestImagesResolveMarketplace(t *testing.T) {
+	images, fake := NewTestImages(t)
+
+	var (
+		amd = fake.AddLocalImage(&marketplace.LocalImage{Label: "ubuntu_jammy", Arch: "x86_64",
+			CompatibleCommercialTypes: []string{"DEV1-S", "PRO2-S"}})
+		arm = fake.AddLocalImage(&marketplace.LocalImage{Label: "ubuntu_jammy", Arch: "arm64",
+			CompatibleCommercialTypes: []string{"COPARM1-2C-8G"}})
+		sbs = fake.AddLocalImage(&marketplace.LocalImage{Label: "ubuntu_jammy", Arch: "x86_64",
+			CompatibleCommercialTypes: []string{"DEV1-S"}, Type: marketplace.LocalImageTypeInstanceSbs})
+		par = fake.AddLocalImage(&marketplace.LocalImage{Label: "ubuntu_jammy", Arch: "x86_64",
+			CompatibleCommercialTypes: []string{"DEV1-S"}, Zone: scw.ZoneFrPar1})
+	)
+
+	fake.AddLocalImage(&marketplace.LocalImage{Label: "debian_bookworm", Arch: "x86_64",
+		CompatibleCommercialTypes: []string{"DEV1-S"}})
+
+	tests := []struct {
+		zone           scw.Zone
+		commercialType string
+		volumeType     string
+		expected       string
+	}{
+		{instancetest.DefaultZone, "DEV1-S", "", amd.ID},
+		{instancetest.DefaultZone, "DEV1-S", "l_ssd", amd.ID},
+		{instancetest.DefaultZone, "COPARM1-2C-8G", "", arm.ID},
+		{instancetest.DefaultZone, "DEV1-S", "sbs_volume", sbs.ID},
+		{scw.ZoneFrPar1, "DEV1-S", "", par.ID},
+	}
+
+	for _, test := range tests {
+		id, err := images.Resolve(context.Background(), "ubuntu_jammy", test.zone, test.commercialType, test.volumeType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if id != test.expected {
+			t.Errorf("Expected %s %s %s to resolve to %s, got %s", test.zone, test.commercialType, test.volumeType,
+				test.expected, id)
+		}
+	}
+
+	_, err := images.Resolve(context.Background(), "ubuntu_jammy", instancetest.DefaultZone, "GP1-XS", "")
+	if err == nil {
+		t.Error("Expected an error for a commercial type without a compatible image")
+	}
+}
+
+// TestImagesResolvePrivate tests resolving the newest private image by name prefix and tag
+func TestImagesResolvePrivate(t *testing.T) {
+	images, fake := NewTestImages(t)
+
+	fake.SetArch("DEV1-S", instance.ArchX86_64)
+	fake.SetArch("COPARM1-2C-8G", instance.ArchArm64)
+
+	at := func(days int) *time.Time {
+		t := time.Date(2024, 1, days, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	var (
+		old    = fake.AddImage(&instance.Image{Name: "nomad-client-1", CreationDate: at(1), Tags: []string{"nomad"}})
+		newest = fake.AddImage(&instance.Image{Name: "nomad-client-2", CreationDate: at(2), Tags: []string{"nomad"}})
+		arm    = fake.AddImage(&instance.Image{Name: "nomad-client-arm", CreationDate: at(1), Arch: instance.ArchArm64,
+			Tags: []string{"nomad"}})
+	)
+
+	fake.AddImage(&instance.Image{Name: "nomad-client-3", CreationDate: at(3), State: instance.ImageStateCreating,
+		Tags: []string{"nomad"}})
+	fake.AddImage(&instance.Image{Name: "nomad-client-4", CreationDate: at(4), Project: "other", Tags: []string{"nomad"}})
+	fake.AddImage(&instance.Image{Name: "nomad-client-5", CreationDate: at(5), Public: true, Tags: []string{"nomad"}})
+	fake.AddImage(&instance.Image{Name: "nomad-server", CreationDate: at(6), Tags: []string{"server"}})
+
+	tests := []struct {
+		ref            string
+		commercialType string
+		expected       string
+	}{
+		{"name:nomad-client", "DEV1-S", newest.ID},
+		{"name:nomad-client-1", "DEV1-S", old.ID},
+		{"name:nomad-client", "COPARM1-2C-8G", arm.ID},
+		{"tag:nomad", "DEV1-S", newest.ID},
+	}
+
+	for _, test := range tests {
+		id, err := images.Resolve(context.Background(), test.ref, instancetest.DefaultZone, test.commercialType, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if id != test.expected {
+			t.Errorf("Expected %s for %s to resolve to %s, got %s", test.ref, test.commercialType, test.expected, id)
+		}
+	}
+
+	// The server types of a zone are only listed once
+	if n := fake.Requests(http.MethodGet, "products/servers"); n != 1 {
+		t.Errorf("Expected the server types to be listed once, got %d", n)
+	}
+
+	for _, ref := range []string{"name:nomad-worker", "tag:worker"} {
+		_, err := images.Resolve(context.Background(), ref, instancetest.DefaultZone, "DEV1-S", "")
+		if err == nil {
+			t.Errorf("Expected an error for %s without a matching image", ref)
+		}
+	}
+
+	_, err := images.Resolve(context.Background(), "tag:nomad", instancetest.DefaultZone, "GP1-XS", "")
+	if err == nil {
+		t.Error("Expected an error for an unknown commercial type")
+	}
+}
+
+// TestImagesCache tests that resolved images are cached until the TTL expires
+func TestImagesCache(t *testing.T) {
+	images, fake := NewTestImages(t)
+
+	now := time.Now()
+	images.now = func() time.Time { return now }
+
+	fake.SetArch("DEV1-S", instance.ArchX86_64)
+	first := fake.AddImage(&instance.Image{Name: "nomad-client-1", CreationDate: &now})
+
+	resolve := func() string {
+		id, err := images.Resolve(context.Background(), "name:nomad-client", instancetest.DefaultZone, "DEV1-S", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return id
+	}
+
+	resolve()
+
+	later := now.Add(time.Hour)
+	second := fake.AddImage(&instance.Image{Name: "nomad-client-2", CreationDate: &later})
+
+	if id := resolve(); id != first.ID {
+		t.Errorf("Expected the cached image %s, got %s", first.ID, id)
+	}
+
+	if n := fake.Requests(http.MethodGet, "images"); n != 1 {
+		t.Errorf("Expected the images to be listed once, got %d", n)
+	}
+
+	now = now.Add(images.TTL)
+
+	if id := resolve(); id != second.ID {
+		t.Errorf("Expected the newest image %s once the cache expired, got %s", second.ID, id)
+	}
+}
+
+// TestCreateServerImageLabel tests creating a server from a marketplace label
+func TestCreateServerImageLabel(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
+	client, err := fake.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := fake.AddLocalImage(&marketplace.LocalImage{Label: "ubuntu_jammy", Arch: "x86_64",
+		CompatibleCommercialTypes: []string{"DEV1-S"}})
+
+	var blueprint Server
+	err = blueprint.Decode(map[string]string{"image": "ubuntu_jammy", "commercial_type": "DEV1-S",
+		"zone": string(instancetest.DefaultZone)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := api.CreateServer(context.Background(), blueprint, &ServerOpt{Images: NewImages(client, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Image == nil || server.Image.ID != image.ID {
+		t.Errorf("Expected the server to be created from image %s, got %v", image.ID, server.Image)
+	}
+
+	if blueprint.Image.ID != "ubuntu_jammy" {
+		t.Errorf("Expected the blueprint to keep the label, got %s", blueprint.Image.ID)
+	}
+}
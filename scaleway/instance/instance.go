@@ -1,6 +1,8 @@
 package instance
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"strings"
 	"time"
@@ -24,8 +26,11 @@ func (a *API) Native() *instance.API {
 }
 
 // RefreshServer refreshes a server object's attributes
-func (a *API) RefreshServer(server *Server) error {
-	resp, err := a.Native().GetServer(&instance.GetServerRequest{Zone: server.Zone, ServerID: server.ID})
+func (a *API) RefreshServer(ctx context.Context, server *Server) (err error) {
+	defer observe("refresh_server", server.Zone, time.Now(), &err)
+
+	resp, err := a.Native().GetServer(&instance.GetServerRequest{Zone: server.Zone, ServerID: server.ID},
+		scw.WithContext(ctx))
 	if err != nil {
 		return err
 	}
@@ -36,8 +41,10 @@ func (a *API) RefreshServer(server *Server) error {
 }
 
 // ListServers performs the ListServerRequest and returns a list of servers
-func (a *API) ListServers(blueprint Server) (*ListServersResponse, error) {
-	resp, err := a.Native().ListServers(blueprint.ListServersRequest())
+func (a *API) ListServers(ctx context.Context, blueprint Server) (_ *ListServersResponse, err error) {
+	defer observe("list_servers", blueprint.Zone, time.Now(), &err)
+
+	resp, err := a.Native().ListServers(blueprint.ListServersRequest(), scw.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -50,12 +57,34 @@ func (a *API) ListServers(blueprint Server) (*ListServersResponse, error) {
 	return r, nil
 }
 
-// ListServersAll iterates over all the pages and returns the sum result
-func (a *API) ListServersAll(blueprint Server) (servers Servers, err error) {
+// ListServersAll iterates over all the pages and returns the sum result, the blueprint zone is used if no zones are given
+func (a *API) ListServersAll(ctx context.Context, blueprint Server, zones ...scw.Zone) (servers Servers, err error) {
+	if len(zones) == 0 {
+		return a.listServersZone(ctx, blueprint)
+	}
+
+	for _, zone := range zones {
+		blueprint.Zone = zone
+
+		s, err := a.listServersZone(ctx, blueprint)
+		if err != nil {
+			return nil, err
+		}
+
+		servers = append(servers, s...)
+	}
+
+	return servers, nil
+}
+
+// listServersZone iterates over all the pages of the blueprint zone and returns the sum result
+func (a *API) listServersZone(ctx context.Context, blueprint Server) (servers Servers, err error) {
+	defer observe("list_servers", blueprint.Zone, time.Now(), &err)
+
 	req := blueprint.ListServersRequest()
 
 	for {
-		resp, err := a.Native().ListServers(req)
+		resp, err := a.Native().ListServers(req, scw.WithContext(ctx))
 		if err != nil {
 			return nil, err
 		}
@@ -71,41 +100,205 @@ func (a *API) ListServersAll(blueprint Server) (servers Servers, err error) {
 	}
 }
 
-// CreateServer creates a new server from the given blueprint
-func (a *API) CreateServer(blueprint Server, opt *ServerOpt) (s Server, err error) {
-	resp, err := a.Native().CreateServer(blueprint.CreateServerRequest())
+// CreateServer creates a new server from the given blueprint, servers that fail to bootstrap are removed again
+func (a *API) CreateServer(ctx context.Context, blueprint Server, opt *ServerOpt) (s Server, err error) {
+	defer observe("create_server", blueprint.Zone, time.Now(), &err)
+
+	return a.createServer(ctx, blueprint, opt, true)
+}
+
+// ProvisionServer creates a new server like CreateServer does, but leaves it powered off so that it can be
+// started later on, see StartServer
+func (a *API) ProvisionServer(ctx context.Context, blueprint Server, opt *ServerOpt) (s Server, err error) {
+	defer observe("provision_server", blueprint.Zone, time.Now(), &err)
+
+	return a.createServer(ctx, blueprint, opt, false)
+}
+
+// createServer creates a new server from the given blueprint and bootstraps it, servers that fail to bootstrap
+// are removed again
+func (a *API) createServer(ctx context.Context, blueprint Server, opt *ServerOpt, start bool) (s Server, err error) {
+	err = opt.resolveImage(ctx, &blueprint)
 	if err != nil {
 		return s, err
 	}
 
-	var (
-		server = Server(*resp.Server)
-	)
-
-	err = a.ApplyServerOpt(server, opt)
+	resp, err := a.Native().CreateServer(blueprint.CreateServerRequest(), scw.WithContext(ctx))
 	if err != nil {
 		return s, err
 	}
 
 	var (
-		timeout = time.Minute * 3
+		server = Server(*resp.Server)
 	)
 
-	err = a.Native().ServerActionAndWait(server.ActionAndWaitRequest(instance.ServerActionPoweron, timeout))
+	err = a.bootstrapServer(ctx, server, opt, start)
 	if err != nil {
-		return s, err
+		return s, a.rollbackServer(server, opt, err)
 	}
 
 	return server, nil
 }
 
+// CreateServerWithTypes creates a new server trying each of the commercial types in order until one has capacity,
+// the blueprint commercial type is used if no types are given
+func (a *API) CreateServerWithTypes(ctx context.Context, blueprint Server, types CommercialTypes, opt *ServerOpt) (Server, error) {
+	return withTypes(blueprint, types, func(blueprint Server) (Server, error) {
+		return a.CreateServer(ctx, blueprint, opt)
+	})
+}
+
+// ProvisionServerWithTypes provisions a new server trying each of the commercial types in order, see CreateServerWithTypes
+func (a *API) ProvisionServerWithTypes(ctx context.Context, blueprint Server, types CommercialTypes, opt *ServerOpt) (Server, error) {
+	return withTypes(blueprint, types, func(blueprint Server) (Server, error) {
+		return a.ProvisionServer(ctx, blueprint, opt)
+	})
+}
+
+// withTypes calls create with the blueprint set to each of the commercial types in order until one has capacity
+func withTypes(blueprint Server, types CommercialTypes, create func(blueprint Server) (Server, error)) (s Server, err error) {
+	if len(types) == 0 {
+		return create(blueprint)
+	}
+
+	for _, t := range types {
+		blueprint.CommercialType = t
+
+		s, err = create(blueprint)
+		if err == nil || !IsCapacityError(err) {
+			return s, err
+		}
+	}
+
+	return s, err
+}
+
+// StartServer removes the `untag` tags from a provisioned server and powers it on. Servers that fail to power on
+// are kept stopped with their tags restored, so that they can be started again later.
+func (a *API) StartServer(ctx context.Context, server *Server, opt *ServerOpt, untag ...string) (err error) {
+	defer observe("start_server", server.Zone, time.Now(), &err)
+
+	tags := append([]string{}, server.Tags...)
+
+	// Tags are removed first, so that a server that is powering on is never taken for a stopped one
+	err = a.updateTags(ctx, server, server.TagsWithout(untag...))
+	if err != nil {
+		return err
+	}
+
+	err = a.Native().ServerActionAndWait(server.ActionAndWaitRequest(instance.ServerActionPoweron,
+		opt.timeouts().PowerOnTimeout()), scw.WithContext(ctx))
+	if err != nil {
+		return a.restoreTags(*server, tags, err)
+	}
+
+	return a.RefreshServer(ctx, server)
+}
+
+// restoreTags restores the tags of a server that failed to power on, the returned error holds both the cause and the
+// outcome of the restore. The restore uses its own context, so that tags are restored even if the start was cancelled.
+func (a *API) restoreTags(server Server, tags []string, cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return &StartError{ServerID: server.ID, Err: cause, RestoreErr: a.updateTags(ctx, &server, tags)}
+}
+
+// StopServer powers off a server, then adds the given tag and removes the `untag` tags once it is stopped. The server
+// is kept together with its volumes and IPs. Servers stopped `inPlace` stay on their hypervisor with their local
+// volumes, others are archived.
+func (a *API) StopServer(ctx context.Context, server *Server, timeouts *Timeouts, inPlace bool, tag string, untag ...string) (err error) {
+	defer observe("stop_server", server.Zone, time.Now(), &err)
+
+	err = a.RefreshServer(ctx, server)
+	if err != nil {
+		return err
+	}
+
+	action := instance.ServerActionPoweroff
+	if inPlace {
+		action = instance.ServerActionStopInPlace
+	}
+
+	if !server.Stopped() {
+		err = a.Native().ServerActionAndWait(server.ActionAndWaitRequest(action, timeouts.PowerOffTimeout()),
+			scw.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.updateTags(ctx, server, append(server.TagsWithout(append([]string{tag}, untag...)...), tag))
+}
+
+// updateTags replaces the tags of the server and refreshes it with the response
+func (a *API) updateTags(ctx context.Context, server *Server, tags []string) error {
+	resp, err := a.Native().UpdateServer(&instance.UpdateServerRequest{Zone: server.Zone, ServerID: server.ID,
+		Tags: &tags}, scw.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	*server = Server(*resp.Server)
+
+	return nil
+}
+
+// ServerTypesAvailability returns the availability of the commercial types in the given zone
+func (a *API) ServerTypesAvailability(ctx context.Context, zone scw.Zone) (_ map[string]instance.ServerTypesAvailability, err error) {
+	defer observe("server_types_availability", zone, time.Now(), &err)
+
+	resp, err := a.Native().GetServerTypesAvailability(&instance.GetServerTypesAvailabilityRequest{Zone: zone},
+		scw.WithAllPages(), scw.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]instance.ServerTypesAvailability, len(resp.Servers))
+	for t, availability := range resp.Servers {
+		r[t] = availability.Availability
+	}
+
+	return r, nil
+}
+
+// bootstrapServer applies the server options and powers on a freshly created server if `start` is set
+func (a *API) bootstrapServer(ctx context.Context, server Server, opt *ServerOpt, start bool) error {
+	err := a.ApplyServerOpt(ctx, server, opt)
+	if err != nil || !start {
+		return err
+	}
+
+	return a.Native().ServerActionAndWait(server.ActionAndWaitRequest(instance.ServerActionPoweron,
+		opt.timeouts().PowerOnTimeout()), scw.WithContext(ctx))
+}
+
+// rollbackServer removes a server that failed to bootstrap, the returned error holds both the cause and the cleanup outcome.
+// The cleanup uses its own context, so that servers are removed even if the bootstrap was cancelled.
+func (a *API) rollbackServer(server Server, opt *ServerOpt, cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opt.timeouts().PowerOffTimeout()+time.Minute)
+	defer cancel()
+
+	err := a.RefreshServer(ctx, &server)
+	if err == nil {
+		err = a.purgeServer(ctx, &server, opt.timeouts(), true)
+	}
+
+	return &CreateError{ServerID: server.ID, Err: cause, CleanupErr: err}
+}
+
 // ApplyServerOpt applies certain options to a server instance
-func (a *API) ApplyServerOpt(server Server, opt *ServerOpt) error {
+func (a *API) ApplyServerOpt(ctx context.Context, server Server, opt *ServerOpt) error {
 	if opt == nil {
 		return nil
 	}
 
-	err := a.ApplyServerUserData(server, opt.UserData)
+	err := a.ApplyServerUserData(ctx, server, opt.UserData)
+	if err != nil {
+		return err
+	}
+
+	err = a.ApplyServerPrivateNetworks(ctx, server, opt.PrivateNetworks, opt.Timeouts.PrivateNICTimeout())
 	if err != nil {
 		return err
 	}
@@ -113,8 +306,46 @@ func (a *API) ApplyServerOpt(server Server, opt *ServerOpt) error {
 	return nil
 }
 
+// ApplyServerPrivateNetworks attaches the given server to the given private networks and waits for the NICs to be ready
+func (a *API) ApplyServerPrivateNetworks(ctx context.Context, server Server, ids []string, timeout time.Duration) (err error) {
+	defer observe("apply_private_networks", server.Zone, time.Now(), &err)
+
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); len(id) == 0 {
+			continue
+		}
+
+		resp, err := a.Native().CreatePrivateNIC(&instance.CreatePrivateNICRequest{
+			Zone:             server.Zone,
+			ServerID:         server.ID,
+			PrivateNetworkID: id,
+		}, scw.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		nic, err := a.Native().WaitForPrivateNIC(&instance.WaitForPrivateNICRequest{
+			Zone:         server.Zone,
+			ServerID:     server.ID,
+			PrivateNicID: resp.PrivateNic.ID,
+			Timeout:      &timeout,
+		}, scw.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		if nic.State != instance.PrivateNICStateAvailable {
+			return fmt.Errorf("private NIC %s for private network %s is in state %s", nic.ID, id, nic.State)
+		}
+	}
+
+	return nil
+}
+
 // ApplyServerUserData applies the given user data to the given server instance
-func (a *API) ApplyServerUserData(server Server, data types.MapString) error {
+func (a *API) ApplyServerUserData(ctx context.Context, server Server, data types.MapString) (err error) {
+	defer observe("apply_user_data", server.Zone, time.Now(), &err)
+
 	if data == nil {
 		return nil
 	}
@@ -128,34 +359,76 @@ func (a *API) ApplyServerUserData(server Server, data types.MapString) error {
 		Zone:     server.Zone,
 		ServerID: server.ID,
 		UserData: m,
-	})
+	}, scw.WithContext(ctx))
 }
 
-// DeleteServer deletes the given server and cleans up any leftover volumes
-func (a *API) DeleteServer(server *Server) error {
-	var (
-		timeout = time.Minute * 5
-	)
+// DeleteServer deletes the given server and cleans up any leftover volumes, volumes with one of the `keep`
+// template keys are detached but not deleted. Flexible IPs are detached but not released, they may be reserved.
+// Timeouts can be nil.
+func (a *API) DeleteServer(ctx context.Context, server *Server, timeouts *Timeouts, keep ...string) (err error) {
+	defer observe("delete_server", server.Zone, time.Now(), &err)
 
 	if len(server.Volumes) == 0 {
-		if err := a.RefreshServer(server); err != nil {
+		if err := a.RefreshServer(ctx, server); err != nil {
 			return err
 		}
 	}
 
-	err := a.Native().ServerActionAndWait(server.ActionAndWaitRequest(instance.ServerActionPoweroff, timeout))
-	if err != nil {
-		return err
+	return a.purgeServer(ctx, server, timeouts, false, keep...)
+}
+
+// purgeServer powers off the given server if needed, deletes it and releases its volumes. Its flexible IPs are
+// released too if `releaseIPs` is set.
+func (a *API) purgeServer(ctx context.Context, server *Server, timeouts *Timeouts, releaseIPs bool, keep ...string) error {
+	if server.State != instance.ServerStateStopped {
+		err := a.Native().ServerActionAndWait(server.ActionAndWaitRequest(instance.ServerActionPoweroff,
+			timeouts.PowerOffTimeout()), scw.WithContext(ctx))
+		if err != nil {
+			return err
+		}
 	}
 
-	err = a.Native().DeleteServer(server.DeleteServerRequest())
+	for _, nic := range server.PrivateNics {
+		err := a.Native().DeletePrivateNIC(&instance.DeletePrivateNICRequest{Zone: server.Zone, ServerID: server.ID,
+			PrivateNicID: nic.ID}, scw.WithContext(ctx))
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+
+	err := a.Native().DeleteServer(server.DeleteServerRequest(), scw.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 
-	for _, volume := range server.Volumes {
-		err := a.Native().DeleteVolume(&instance.DeleteVolumeRequest{Zone: server.Zone, VolumeID: volume.ID})
-		if err != nil {
+	kept := make(map[string]bool, len(keep))
+	for _, key := range keep {
+		kept[key] = true
+	}
+
+	for key, volume := range server.Volumes {
+		if kept[key] {
+			continue
+		}
+
+		err := a.Native().DeleteVolume(&instance.DeleteVolumeRequest{Zone: server.Zone, VolumeID: volume.ID}, scw.WithContext(ctx))
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+
+	if !releaseIPs {
+		return nil
+	}
+
+	// Dynamic IPs are released together with the server, others have to be released manually
+	for _, ip := range server.PublicIPs {
+		if ip.Dynamic {
+			continue
+		}
+
+		err := a.Native().DeleteIP(&instance.DeleteIPRequest{Zone: server.Zone, IP: ip.ID}, scw.WithContext(ctx))
+		if err != nil && !IsNotFound(err) {
 			return err
 		}
 	}
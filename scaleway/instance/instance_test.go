@@ -1,40 +1,38 @@
 package instance
 
 import (
-	"os"
+	"context"
+	"errors"
+	"net/http"
 	"testing"
 
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
 	"github.com/scaleway/scaleway-sdk-go/scw"
 )
 
-// NewTestClient returns a new test client
-func NewTestClient(t *testing.T) (*scw.Client, error) {
-	env := [][]string{
-		{"SCW_DEFAULT_REGION", "nl-ams"},
-		{"SCW_DEFAULT_ZONE", "nl-ams-1"},
-	}
-
-	for _, v := range env {
-		t.Setenv(v[0], v[1])
-	}
+// NewTestAPI returns a new API instance backed by a fake Scaleway Instance API
+func NewTestAPI(t *testing.T) (*API, *instancetest.API) {
+	fake := instancetest.NewAPI()
+	t.Cleanup(fake.Close)
 
-	client, err := scw.NewClient(scw.WithAuth(os.Getenv("SCW_ACCESS_KEY"), os.Getenv("SCW_SECRET_KEY")),
-		scw.WithDefaultProjectID(os.Getenv("SCW_DEFAULT_PROJECT_ID")), scw.WithEnv())
+	client, err := fake.Client()
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
 	}
 
-	return client, nil
+	return NewAPI(client), fake
 }
 
 // NewTestServer returns a new test server instance
 func NewTestServer() (server Server, err error) {
 	return server, server.Decode(map[string]string{
-		"image":           "ubuntu_focal",
+		"image":           "0d1cf4a3-aae9-4294-9fd9-fefffb297615",
 		"commercial_type": "DEV1-S",
 		"dynamic_ip":      "true",
+		"routed_ip":       "true",
 		"enable_ipv6":     "true",
-		"zone":            "nl-ams-1", // Why do we need to set this? The env variable should take care of that
+		"zone":            "nl-ams-1",
 		"security_group":  "9aada4ae-7933-43e1-963d-adf066fdeb8b",
 	})
 }
@@ -48,29 +46,252 @@ func NewTestServerOpt() (opt ServerOpt, err error) {
 
 // TestListServersAll tests the ListServersAll method
 func TestListServersAll(t *testing.T) {
-	client, err := NewTestClient(t)
+	api, fake := NewTestAPI(t)
+
+	server, err := NewTestServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spread the managed servers over multiple pages
+	for i := 0; i < 150; i++ {
+		fake.AddServer(&instance.Server{Name: "managed", Tags: server.Tags, CommercialType: "DEV1-S"})
+	}
+
+	fake.AddServer(&instance.Server{Name: "unmanaged", Tags: []string{"nomad"}, CommercialType: "DEV1-S"})
+
+	servers, err := api.ListServersAll(context.Background(), server)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if servers.Count() != 150 {
+		t.Errorf("Expected 150 servers, got %d", servers.Count())
+	}
+
+	if servers.WithName("unmanaged") != nil {
+		t.Error("Expected servers without the autoscaler tags to be filtered out")
+	}
+}
+
+// TestCreateServer tests the CreateServer method
+func TestCreateServer(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
 	server, err := NewTestServer()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = NewAPI(client).ListServersAll(server)
+	opt, err := NewTestServerOpt()
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	server, err = api.CreateServer(context.Background(), server, &opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := fake.GetServer(server.ID)
+	if created == nil {
+		t.Fatal("Expected server to exist after creation")
+	}
+
+	if created.State != instance.ServerStateRunning {
+		t.Errorf("Expected server to be running, got %s", created.State)
+	}
+
+	data := fake.UserData(server.ID)
+	if data["foo"] != "bar" || data["hello"] != "world" {
+		t.Errorf("Expected user data to be set, got %v", data)
+	}
 }
 
-// TestCreateServer tests the CreateServer method
-func TestCreateServer(t *testing.T) {
-	client, err := NewTestClient(t)
+// TestDeleteServer tests the DeleteServer method
+func TestDeleteServer(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
+	server, err := NewTestServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err = api.CreateServer(context.Background(), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete a copy without volumes to make sure they are refreshed
+	err = api.DeleteServer(context.Background(), &Server{ID: server.ID, Zone: server.Zone}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(fake.Servers()); n != 0 {
+		t.Errorf("Expected no servers after deletion, got %d", n)
+	}
+
+	if n := len(fake.Volumes()); n != 0 {
+		t.Errorf("Expected no volumes after deletion, got %d", n)
+	}
+
+	// Flexible IPs may be reserved, they are only detached
+	ips := fake.IPs()
+	if len(ips) != 1 {
+		t.Fatalf("Expected the flexible IP to be kept after deletion, got %d IPs", len(ips))
+	}
+
+	if ips[0].Server != nil {
+		t.Error("Expected the flexible IP to be detached")
+	}
+}
+
+// TestCreateServerRollback tests that servers failing to bootstrap are removed
+func TestCreateServerRollback(t *testing.T) {
+	faults := map[string]instancetest.Fault{
+		"user data": {Method: http.MethodPatch, Path: "servers/*/user_data/*"},
+		"power on":  {Method: http.MethodPost, Path: "servers/*/action"},
+	}
+
+	for name, fault := range faults {
+		t.Run(name, func(t *testing.T) {
+			api, fake := NewTestAPI(t)
+
+			fault.Count = 1
+			fault.Err = &instancetest.Error{Status: http.StatusInternalServerError, Type: "internal_error",
+				Message: "boom"}
+			fake.Inject(fault)
+
+			server, err := NewTestServer()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opt, err := NewTestServerOpt()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = api.CreateServer(context.Background(), server, &opt)
+
+			var createErr *CreateError
+			if !errors.As(err, &createErr) {
+				t.Fatalf("Expected a create error, got %v", err)
+			}
+
+			if createErr.CleanupErr != nil {
+				t.Errorf("Expected cleanup to succeed, got %s", createErr.CleanupErr)
+			}
+
+			if n := len(fake.Servers()) + len(fake.Volumes()) + len(fake.IPs()); n != 0 {
+				t.Errorf("Expected no leftover resources, got %d", n)
+			}
+		})
+	}
+}
+
+// TestCreateServerRollbackFailure tests that a failed cleanup is reported alongside the original error
+func TestCreateServerRollbackFailure(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
+	for _, f := range []instancetest.Fault{
+		{Method: http.MethodPatch, Path: "servers/*/user_data/*"},
+		{Method: http.MethodDelete, Path: "servers/*"},
+	} {
+		f.Err = &instancetest.Error{Status: http.StatusInternalServerError, Type: "internal_error", Message: "boom"}
+		fake.Inject(f)
+	}
+
+	server, err := NewTestServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt, err := NewTestServerOpt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.CreateServer(context.Background(), server, &opt)
+
+	var createErr *CreateError
+	if !errors.As(err, &createErr) {
+		t.Fatalf("Expected a create error, got %v", err)
+	}
+
+	if createErr.Err == nil || createErr.CleanupErr == nil {
+		t.Errorf("Expected both the bootstrap and cleanup errors, got %s", err)
+	}
+}
+
+// TestRefreshServer tests the RefreshServer method while the server transitions between states
+func TestRefreshServer(t *testing.T) {
+	api, fake := NewTestAPI(t)
+	fake.Transitions = 1
+
+	created := fake.AddServer(&instance.Server{Name: "refresh", State: instance.ServerStateStopped})
+
+	_, err := api.Native().ServerAction(&instance.ServerActionRequest{Zone: created.Zone, ServerID: created.ID,
+		Action: instance.ServerActionPoweron})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := Server{ID: created.ID, Zone: created.Zone}
+
+	for _, expected := range []instance.ServerState{instance.ServerStateStarting, instance.ServerStateRunning} {
+		err = api.RefreshServer(context.Background(), &server)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if server.State != expected {
+			t.Errorf("Expected server to be %s, got %s", expected, server.State)
+		}
+	}
+}
+
+// TestCreateServerWithTypes tests falling back to the next commercial type on capacity errors
+func TestCreateServerWithTypes(t *testing.T) {
+	api, fake := NewTestAPI(t)
+	fake.SetAvailability(instancetest.DefaultZone, "DEV1-S", instance.ServerTypesAvailabilityShortage)
+	fake.Inject(instancetest.Fault{Method: http.MethodPost, Path: "servers", Count: 1,
+		Err: &instancetest.Error{Status: http.StatusForbidden, Type: "quotas_exceeded", Message: "quota exceeded"}})
+
+	server, err := NewTestServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first type exceeds the quota and the second is out of stock
+	server, err = api.CreateServerWithTypes(context.Background(), server, CommercialTypes{"DEV1-M", "DEV1-S", "DEV1-L"}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if server.CommercialType != "DEV1-L" {
+		t.Errorf("Expected a DEV1-L server, got %s", server.CommercialType)
+	}
+
+	// Other errors are returned immediately
+	fake.Inject(instancetest.Fault{Method: http.MethodPost, Path: "servers", Count: 1,
+		Err: &instancetest.Error{Status: http.StatusInternalServerError, Type: "internal_error", Message: "boom"}})
+
+	_, err = api.CreateServerWithTypes(context.Background(), server, CommercialTypes{"DEV1-M", "DEV1-L"}, nil)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if n := len(fake.Servers()); n != 1 {
+		t.Errorf("Expected 1 server, got %d", n)
+	}
+}
+
+// TestProvisionServer tests provisioning a powered off server and starting it later on
+func TestProvisionServer(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
 	server, err := NewTestServer()
 	if err != nil {
 		t.Fatal(err)
@@ -81,15 +302,257 @@ func TestCreateServer(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	api := NewAPI(client)
+	server.Tags = append(server.Tags, "warm")
+
+	server, err = api.ProvisionServerWithTypes(context.Background(), server, CommercialTypes{"DEV1-S"}, &opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state := fake.GetServer(server.ID).State; state != instance.ServerStateStopped {
+		t.Errorf("Expected provisioned server to be stopped, got %s", state)
+	}
+
+	if data := fake.UserData(server.ID); data["foo"] != "bar" {
+		t.Errorf("Expected user data to be set on provisioning, got %v", data)
+	}
+
+	err = api.StartServer(context.Background(), &server, &opt, "warm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := fake.GetServer(server.ID)
+	if started.State != instance.ServerStateRunning {
+		t.Errorf("Expected started server to be running, got %s", started.State)
+	}
+
+	if (&Server{Tags: started.Tags}).HasTag("warm") || server.HasTag("warm") {
+		t.Errorf("Expected the warm tag to be removed, got %v", started.Tags)
+	}
+
+	if !server.HasTag("autoscaler") {
+		t.Errorf("Expected the other tags to be kept, got %v", server.Tags)
+	}
+}
+
+// TestStartServerFailure tests that servers failing to power on are kept stopped with their tags
+func TestStartServerFailure(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
+	server, err := NewTestServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Tags = append(server.Tags, "warm")
+
+	server, err = api.ProvisionServer(context.Background(), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Inject(instancetest.Fault{Method: http.MethodPost, Path: "servers/*/action", Count: 1,
+		Err: &instancetest.Error{Status: http.StatusConflict, Type: "conflict", Message: "boom"}})
+
+	err = api.StartServer(context.Background(), &server, nil, "warm")
+
+	var startErr *StartError
+	if !errors.As(err, &startErr) || startErr.RestoreErr != nil {
+		t.Fatalf("Expected a start error with the tags restored, got %v", err)
+	}
+
+	kept := fake.GetServer(server.ID)
+	if kept == nil {
+		t.Fatal("Expected the server to be kept after failing to start")
+	}
+
+	if kept.State != instance.ServerStateStopped || !(&Server{Tags: kept.Tags}).HasTag("warm") {
+		t.Errorf("Expected the server to be stopped with the warm tag, got %s %v", kept.State, kept.Tags)
+	}
+
+	if n := len(fake.Volumes()); n != 1 {
+		t.Errorf("Expected the volume to be kept, got %d volumes", n)
+	}
+}
+
+// TestStopServer tests stopping servers in place or archiving them while keeping them
+func TestStopServer(t *testing.T) {
+	for inPlace, state := range map[bool]instance.ServerState{
+		true:  instance.ServerStateStoppedInPlace,
+		false: instance.ServerStateStopped,
+	} {
+		api, fake := NewTestAPI(t)
+
+		server, err := NewTestServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server, err = api.CreateServer(context.Background(), server, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = api.Native().UpdateServer(&instance.UpdateServerRequest{Zone: server.Zone, ServerID: server.ID,
+			Tags: scw.StringsPtr(append(server.Tags, "warm"))})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stub := Server{ID: server.ID, Zone: server.Zone}
+
+		err = api.StopServer(context.Background(), &stub, nil, inPlace, "hibernated", "warm")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stopped := fake.GetServer(server.ID)
+		if stopped == nil {
+			t.Fatal("Expected the server to be kept")
+		}
+
+		if stopped.State != state {
+			t.Errorf("Expected server to be %s, got %s", state, stopped.State)
+		}
+
+		if !stub.HasTag("hibernated") || !stub.HasTag("autoscaler") {
+			t.Errorf("Expected the hibernated tag to be added, got %v", stub.Tags)
+		}
+
+		if stub.HasTag("warm") {
+			t.Errorf("Expected the warm tag to be removed, got %v", stub.Tags)
+		}
+
+		if n := len(fake.Volumes()); n != 1 {
+			t.Errorf("Expected the volume to be kept, got %d volumes", n)
+		}
+	}
+}
+
+// TestCreateServerVolumes tests creating servers with custom volumes and keeping data volumes on deletion
+func TestCreateServerVolumes(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
+	var server Server
+	err := server.Decode(map[string]string{
+		"image":            "0d1cf4a3-aae9-4294-9fd9-fefffb297615",
+		"commercial_type":  "DEV1-S",
+		"zone":             "nl-ams-1",
+		"root_volume_size": "40",
+		"root_volume_type": "b_ssd",
+		"data_volumes":     "50:b_ssd:keep,100:b_ssd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err = api.CreateServer(context.Background(), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := fake.GetServer(server.ID)
+
+	expected := map[string]scw.Size{"0": 40 * scw.GB, "1": 50 * scw.GB, "2": 100 * scw.GB}
+	for key, size := range expected {
+		volume, ok := created.Volumes[key]
+		if !ok {
+			t.Fatalf("Expected volume %s to exist", key)
+		}
+
+		if volume.Size != size || volume.VolumeType != instance.VolumeServerVolumeTypeBSSD {
+			t.Errorf("Expected volume %s to be a %s b_ssd volume, got %s %s", key, size, volume.Size, volume.VolumeType)
+		}
+	}
+
+	err = api.DeleteServer(context.Background(), &Server{ID: server.ID, Zone: server.Zone}, nil, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumes := fake.Volumes()
+	if len(volumes) != 1 || volumes[0].ID != created.Volumes["1"].ID {
+		t.Errorf("Expected only volume 1 to be kept, got %d volumes", len(volumes))
+	}
+}
+
+// TestCreateServerPrivateNetworks tests attaching servers to private networks and detaching them on deletion
+func TestCreateServerPrivateNetworks(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
+	server, err := NewTestServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opt ServerOpt
+	err = opt.Decode(map[string]string{
+		"private_networks": "5d2a0fc6-3cd8-4d8e-9d1c-4f4b3b1b6f7d,a3e4b1f2-7c1a-4a3b-8f5e-2b6d9c0e1f3a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := api.CreateServer(context.Background(), server, &opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nics := fake.PrivateNICs()
+	if len(nics) != 2 {
+		t.Fatalf("Expected 2 private NICs, got %d", len(nics))
+	}
 
-	server, err = api.CreateServer(server, &opt)
+	for _, nic := range nics {
+		if nic.State != instance.PrivateNICStateAvailable {
+			t.Errorf("Expected private NIC %s to be available, got %s", nic.ID, nic.State)
+		}
+	}
+
+	err = api.DeleteServer(context.Background(), &Server{ID: created.ID, Zone: created.Zone}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = api.DeleteServer(&server)
+	if n := fake.Requests(http.MethodDelete, "servers/*/private_nics/*"); n != 2 {
+		t.Errorf("Expected 2 private NIC deletions, got %d", n)
+	}
+
+	// Servers that cannot be attached are rolled back
+	fake.Inject(instancetest.Fault{Method: http.MethodPost, Path: "servers/*/private_nics", Count: 1,
+		Err: &instancetest.Error{Status: http.StatusNotFound, Type: "not_found", Message: "private network not found"}})
+
+	_, err = api.CreateServer(context.Background(), server, &opt)
+
+	var createErr *CreateError
+	if !errors.As(err, &createErr) || createErr.CleanupErr != nil {
+		t.Fatalf("Expected a create error with a successful cleanup, got %v", err)
+	}
+
+	if n := len(fake.Servers()); n != 0 {
+		t.Errorf("Expected no servers after rollback, got %d", n)
+	}
+}
+
+// TestCreateServerCancelled tests that cancelled contexts stop server creation
+func TestCreateServerCancelled(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
+	server, err := NewTestServer()
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = api.CreateServer(ctx, server, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected a context canceled error, got %v", err)
+	}
+
+	if n := len(fake.Servers()); n != 0 {
+		t.Errorf("Expected no servers to be created, got %d", n)
+	}
 }
@@ -0,0 +1,812 @@
+package instancetest
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/api/marketplace/v2"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// prefix is the path prefix of all zoned Instance API endpoints
+const prefix = "/instance/v1/zones/"
+
+// localImagesPath is the path of the Marketplace API local images endpoint, it is zoned by its query
+const localImagesPath = "/marketplace/v2/local-images"
+
+// defaultVolumeSize is the size of the boot volume created when a request does not specify volumes
+const defaultVolumeSize = 20 * scw.GB
+
+// handle routes a request to the matching endpoint handler
+func (a *API) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-Token") != SecretKey {
+		writeError(w, &Error{Status: http.StatusUnauthorized, Type: "denied_authentication",
+			Message: "invalid credentials"})
+		return
+	}
+
+	var parts []string
+
+	switch {
+	case r.URL.Path == localImagesPath:
+		parts = []string{r.URL.Query().Get("zone"), "local-images"}
+	case strings.HasPrefix(r.URL.Path, prefix):
+		parts = strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	default:
+		writeError(w, invalid("unknown path %s", r.URL.Path))
+		return
+	}
+
+	zone := scw.Zone(parts[0])
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.requests = append(a.requests, r.Method+"/"+strings.Join(parts[1:], "/"))
+
+	if err := a.fault(r.Method, parts[1:]); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	switch {
+	case match(parts, "*", "servers") && r.Method == http.MethodGet:
+		a.listServers(w, r, zone)
+	case match(parts, "*", "servers") && r.Method == http.MethodPost:
+		a.createServer(w, r, zone)
+	case match(parts, "*", "servers", "*") && r.Method == http.MethodGet:
+		a.getServer(w, zone, parts[2])
+	case match(parts, "*", "servers", "*") && r.Method == http.MethodPatch:
+		a.updateServer(w, r, zone, parts[2])
+	case match(parts, "*", "servers", "*") && r.Method == http.MethodDelete:
+		a.deleteServer(w, zone, parts[2])
+	case match(parts, "*", "servers", "*", "action") && r.Method == http.MethodPost:
+		a.serverAction(w, r, zone, parts[2])
+	case match(parts, "*", "servers", "*", "user_data") && r.Method == http.MethodGet:
+		a.listUserData(w, zone, parts[2])
+	case match(parts, "*", "servers", "*", "user_data", "*"):
+		a.userData(w, r, zone, parts[2], parts[4])
+	case match(parts, "*", "servers", "*", "private_nics") && r.Method == http.MethodPost:
+		a.createPrivateNIC(w, r, zone, parts[2])
+	case match(parts, "*", "servers", "*", "private_nics", "*") && r.Method == http.MethodGet:
+		a.getPrivateNIC(w, zone, parts[2], parts[4])
+	case match(parts, "*", "servers", "*", "private_nics", "*") && r.Method == http.MethodDelete:
+		a.deletePrivateNIC(w, zone, parts[2], parts[4])
+	case match(parts, "*", "volumes", "*") && r.Method == http.MethodGet:
+		a.getVolume(w, zone, parts[2])
+	case match(parts, "*", "volumes", "*") && r.Method == http.MethodDelete:
+		a.deleteVolume(w, zone, parts[2])
+	case match(parts, "*", "ips", "*") && r.Method == http.MethodGet:
+		a.getIP(w, zone, parts[2])
+	case match(parts, "*", "ips", "*") && r.Method == http.MethodDelete:
+		a.deleteIP(w, zone, parts[2])
+	case match(parts, "*", "products", "servers", "availability") && r.Method == http.MethodGet:
+		a.serverTypesAvailability(w, zone)
+	case match(parts, "*", "products", "servers") && r.Method == http.MethodGet:
+		a.listServersTypes(w)
+	case match(parts, "*", "images") && r.Method == http.MethodGet:
+		a.listImages(w, r, zone)
+	case match(parts, "*", "local-images") && r.Method == http.MethodGet:
+		a.listLocalImages(w, r, zone)
+	default:
+		writeError(w, invalid("unsupported endpoint %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// match reports whether the path parts match the given pattern, `*` matches any single part
+func match(parts []string, pattern ...string) bool {
+	if len(parts) != len(pattern) {
+		return false
+	}
+
+	for i, p := range pattern {
+		if p != "*" && p != parts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookup returns the server with the given ID in the given zone, the caller must hold the lock
+func (a *API) lookup(zone scw.Zone, id string) (*server, *Error) {
+	s, ok := a.servers[id]
+	if !ok || s.Zone != zone {
+		return nil, notFound("instance_server", id)
+	}
+
+	return s, nil
+}
+
+// listServers handles `GET /servers`
+func (a *API) listServers(w http.ResponseWriter, r *http.Request, zone scw.Zone) {
+	query := r.URL.Query()
+
+	var matches []*instance.Server
+	for _, s := range a.sorted() {
+		a.observe(s)
+
+		if s.Zone != zone || !filter(s.Server, query) {
+			continue
+		}
+
+		matches = append(matches, s.Server)
+	}
+
+	page, perPage := pagination(query)
+	start, end := (page-1)*perPage, page*perPage
+
+	if start > len(matches) {
+		start = len(matches)
+	}
+
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(matches)))
+	writeJSON(w, http.StatusOK, &instance.ListServersResponse{
+		TotalCount: uint32(len(matches)),
+		Servers:    append([]*instance.Server{}, matches[start:end]...),
+	})
+}
+
+// filter reports whether the server matches the list query
+func filter(s *instance.Server, query map[string][]string) bool {
+	get := func(key string) string {
+		if v := query[key]; len(v) > 0 {
+			return v[0]
+		}
+
+		return ""
+	}
+
+	if name := get("name"); len(name) > 0 && !strings.Contains(s.Name, name) {
+		return false
+	}
+
+	if ctype := get("commercial_type"); len(ctype) > 0 && s.CommercialType != ctype {
+		return false
+	}
+
+	if state := get("state"); len(state) > 0 && string(s.State) != state {
+		return false
+	}
+
+	if tags := get("tags"); len(tags) > 0 {
+		for _, tag := range strings.Split(tags, ",") {
+			if !contains(s.Tags, tag) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// pagination returns the requested page and page size
+func pagination(query map[string][]string) (page, perPage int) {
+	page, perPage = 1, 50
+
+	if v, ok := query["page"]; ok {
+		if n, err := strconv.Atoi(v[0]); err == nil && n > 0 {
+			page = n
+		}
+	}
+
+	if v, ok := query["per_page"]; ok {
+		if n, err := strconv.Atoi(v[0]); err == nil && n > 0 {
+			perPage = n
+		}
+	}
+
+	return page, perPage
+}
+
+// createServer handles `POST /servers`
+func (a *API) createServer(w http.ResponseWriter, r *http.Request, zone scw.Zone) {
+	var req instance.CreateServerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, invalid("could not decode request: %s", err))
+		return
+	}
+
+	if len(req.CommercialType) == 0 {
+		writeError(w, invalid("commercial_type is required"))
+		return
+	}
+
+	if len(req.Image) == 0 && len(req.Volumes) == 0 {
+		writeError(w, invalid("image or volumes are required"))
+		return
+	}
+
+	if a.availability[zone][req.CommercialType] == instance.ServerTypesAvailabilityShortage {
+		writeError(w, &Error{Status: http.StatusBadRequest, Type: "out_of_stock",
+			Message: "server type is out of stock", Resource: req.CommercialType})
+		return
+	}
+
+	now := time.Now()
+	srv := &instance.Server{
+		ID:             uuid(),
+		Name:           req.Name,
+		Hostname:       req.Name,
+		Tags:           append([]string{}, req.Tags...),
+		CommercialType: req.CommercialType,
+		CreationDate:   &now,
+		EnableIPv6:     req.EnableIPv6,
+		State:          instance.ServerStateStopped,
+		StateDetail:    string(instance.ServerStateStopped),
+		AllowedActions: allowedActions(instance.ServerStateStopped),
+		Volumes:        make(map[string]*instance.VolumeServer),
+		Zone:           zone,
+	}
+
+	if req.Project != nil {
+		srv.Project = *req.Project
+	}
+
+	if req.DynamicIPRequired != nil {
+		srv.DynamicIPRequired = *req.DynamicIPRequired
+	}
+
+	if req.RoutedIPEnabled != nil {
+		srv.RoutedIPEnabled = *req.RoutedIPEnabled
+	}
+
+	if len(req.Image) > 0 {
+		srv.Image = &instance.Image{ID: req.Image, Zone: zone}
+	}
+
+	if req.SecurityGroup != nil {
+		srv.SecurityGroup = &instance.SecurityGroupSummary{ID: *req.SecurityGroup}
+	}
+
+	if req.PlacementGroup != nil {
+		srv.PlacementGroup = &instance.PlacementGroup{ID: *req.PlacementGroup, Zone: zone}
+	}
+
+	// The boot volume is created from the image unless specified otherwise
+	size := defaultVolumeSize
+	templates := map[string]*instance.VolumeServerTemplate{"0": {Size: &size}}
+
+	for key, tmpl := range req.Volumes {
+		if key == "0" && tmpl.Size == nil {
+			tmpl.Size = &size
+		}
+
+		templates[key] = tmpl
+	}
+
+	for key, tmpl := range templates {
+		volume := a.createVolume(srv, key, tmpl)
+		srv.Volumes[key] = volume
+	}
+
+	// Routed IPs are allocated as flexible IPs that outlive the server
+	if srv.RoutedIPEnabled && srv.DynamicIPRequired {
+		srv.PublicIP = a.createIP(srv)
+		srv.PublicIPs = []*instance.ServerIP{srv.PublicIP}
+	}
+
+	a.add(srv)
+
+	writeJSON(w, http.StatusCreated, &instance.CreateServerResponse{Server: srv})
+}
+
+// createVolume creates a volume from a template and attaches it to the given server, the caller must hold the lock
+func (a *API) createVolume(srv *instance.Server, key string, tmpl *instance.VolumeServerTemplate) *instance.VolumeServer {
+	now := time.Now()
+	volume := &instance.Volume{
+		ID:           uuid(),
+		Name:         srv.Name + "-" + key,
+		VolumeType:   instance.VolumeVolumeTypeLSSD,
+		CreationDate: &now,
+		Project:      srv.Project,
+		Server:       &instance.ServerSummary{ID: srv.ID, Name: srv.Name},
+		State:        instance.VolumeStateAvailable,
+		Zone:         srv.Zone,
+	}
+
+	if tmpl != nil {
+		if tmpl.Size != nil {
+			volume.Size = *tmpl.Size
+		}
+
+		if len(tmpl.VolumeType) > 0 {
+			volume.VolumeType = tmpl.VolumeType
+		}
+
+		if tmpl.Name != nil {
+			volume.Name = *tmpl.Name
+		}
+	}
+
+	a.volumes[volume.ID] = volume
+
+	return &instance.VolumeServer{
+		ID:           volume.ID,
+		Name:         volume.Name,
+		Server:       volume.Server,
+		Size:         volume.Size,
+		VolumeType:   instance.VolumeServerVolumeType(volume.VolumeType),
+		CreationDate: volume.CreationDate,
+		State:        instance.VolumeServerStateAvailable,
+		Project:      volume.Project,
+		Boot:         key == "0",
+		Zone:         volume.Zone,
+	}
+}
+
+// createIP allocates a routed flexible IP and attaches it to the given server, the caller must hold the lock
+func (a *API) createIP(srv *instance.Server) *instance.ServerIP {
+	a.sequence++
+
+	ip := &instance.IP{
+		ID:      uuid(),
+		Address: net.IPv4(51, 15, byte(a.sequence>>8), byte(a.sequence)),
+		Server:  &instance.ServerSummary{ID: srv.ID, Name: srv.Name},
+		Project: srv.Project,
+		Type:    instance.IPTypeRoutedIPv4,
+		State:   instance.IPStateAttached,
+		Zone:    srv.Zone,
+	}
+
+	a.ips[ip.ID] = ip
+
+	return &instance.ServerIP{
+		ID:               ip.ID,
+		Address:          ip.Address,
+		Family:           instance.ServerIPIPFamilyInet,
+		ProvisioningMode: instance.ServerIPProvisioningModeManual,
+		State:            instance.ServerIPStateAttached,
+	}
+}
+
+// getServer handles `GET /servers/{id}`
+func (a *API) getServer(w http.ResponseWriter, zone scw.Zone, id string) {
+	s, err := a.lookup(zone, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	a.observe(s)
+
+	writeJSON(w, http.StatusOK, &instance.GetServerResponse{Server: s.Server})
+}
+
+// updateServer handles `PATCH /servers/{id}`, only the name and the tags can be updated
+func (a *API) updateServer(w http.ResponseWriter, r *http.Request, zone scw.Zone, id string) {
+	s, err := a.lookup(zone, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req struct {
+		Name *string   `json:"name"`
+		Tags *[]string `json:"tags"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, invalid("could not decode request: %s", err))
+		return
+	}
+
+	if req.Name != nil {
+		s.Name = *req.Name
+	}
+
+	if req.Tags != nil {
+		s.Tags = append([]string{}, *req.Tags...)
+	}
+
+	s.modified()
+
+	writeJSON(w, http.StatusOK, &instance.UpdateServerResponse{Server: s.Server})
+}
+
+// deleteServer handles `DELETE /servers/{id}`, only stopped servers can be deleted
+func (a *API) deleteServer(w http.ResponseWriter, zone scw.Zone, id string) {
+	s, err := a.lookup(zone, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if s.State != instance.ServerStateStopped {
+		writeError(w, invalid("instance should be stopped, current state is %s", s.State))
+		return
+	}
+
+	a.remove(s, false)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remove removes a server and either detaches or deletes its volumes, the caller must hold the lock
+func (a *API) remove(s *server, volumes bool) {
+	for _, v := range s.Volumes {
+		if volume, ok := a.volumes[v.ID]; ok {
+			if volumes {
+				delete(a.volumes, v.ID)
+			} else {
+				volume.Server = nil
+			}
+		}
+	}
+
+	for _, ip := range a.ips {
+		if ip.Server != nil && ip.Server.ID == s.ID {
+			ip.Server, ip.State = nil, instance.IPStateDetached
+		}
+	}
+
+	delete(a.servers, s.ID)
+}
+
+// serverAction handles `POST /servers/{id}/action`
+func (a *API) serverAction(w http.ResponseWriter, r *http.Request, zone scw.Zone, id string) {
+	s, err := a.lookup(zone, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req instance.ServerActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, invalid("could not decode request: %s", err))
+		return
+	}
+
+	if len(req.Action) == 0 {
+		req.Action = instance.ServerActionPoweron
+	}
+
+	if !containsAction(s.AllowedActions, req.Action) {
+		writeError(w, invalid("action %s is not allowed in state %s", req.Action, s.State))
+		return
+	}
+
+	switch req.Action {
+	case instance.ServerActionPoweron:
+		a.transition(s, instance.ServerStateStarting, instance.ServerStateRunning)
+	case instance.ServerActionPoweroff:
+		a.transition(s, instance.ServerStateStopping, instance.ServerStateStopped)
+	case instance.ServerActionStopInPlace:
+		a.transition(s, instance.ServerStateStopping, instance.ServerStateStoppedInPlace)
+	case instance.ServerActionReboot:
+		a.transition(s, instance.ServerStateStarting, instance.ServerStateRunning)
+	case instance.ServerActionTerminate:
+		a.remove(s, true)
+	default:
+		writeError(w, invalid("action %s is not supported", req.Action))
+		return
+	}
+
+	now := time.Now()
+	writeJSON(w, http.StatusAccepted, &instance.ServerActionResponse{Task: &instance.Task{
+		ID:          uuid(),
+		Description: string(req.Action),
+		StartedAt:   &now,
+		Status:      instance.TaskStatusPending,
+		HrefFrom:    "/servers/" + id + "/action",
+		Zone:        zone,
+	}})
+}
+
+// listUserData handles `GET /servers/{id}/user_data`
+func (a *API) listUserData(w http.ResponseWriter, zone scw.Zone, id string) {
+	s, err := a.lookup(zone, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	keys := []string{}
+	for k := range s.userData {
+		keys = append(keys, k)
+	}
+
+	writeJSON(w, http.StatusOK, &instance.ListServerUserDataResponse{UserData: keys})
+}
+
+// userData handles `GET`, `PATCH` and `DELETE` on `/servers/{id}/user_data/{key}`
+func (a *API) userData(w http.ResponseWriter, r *http.Request, zone scw.Zone, id, key string) {
+	s, err := a.lookup(zone, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := s.userData[key]
+		if !ok {
+			writeError(w, notFound("user_data", key))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(data)
+	case http.MethodPatch:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, invalid("could not read request: %s", err))
+			return
+		}
+
+		s.userData[key] = data
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(s.userData, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, invalid("unsupported method %s", r.Method))
+	}
+}
+
+// getVolume handles `GET /volumes/{id}`
+func (a *API) getVolume(w http.ResponseWriter, zone scw.Zone, id string) {
+	volume, ok := a.volumes[id]
+	if !ok || volume.Zone != zone {
+		writeError(w, notFound("instance_volume", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &instance.GetVolumeResponse{Volume: volume})
+}
+
+// deleteVolume handles `DELETE /volumes/{id}`, only detached volumes can be deleted
+func (a *API) deleteVolume(w http.ResponseWriter, zone scw.Zone, id string) {
+	volume, ok := a.volumes[id]
+	if !ok || volume.Zone != zone {
+		writeError(w, notFound("instance_volume", id))
+		return
+	}
+
+	if volume.Server != nil {
+		writeError(w, invalid("volume is attached to server %s", volume.Server.ID))
+		return
+	}
+
+	delete(a.volumes, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getIP handles `GET /ips/{id}`
+func (a *API) getIP(w http.ResponseWriter, zone scw.Zone, id string) {
+	ip, ok := a.ips[id]
+	if !ok || ip.Zone != zone {
+		writeError(w, notFound("instance_ip", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &instance.GetIPResponse{IP: ip})
+}
+
+// deleteIP handles `DELETE /ips/{id}`
+func (a *API) deleteIP(w http.ResponseWriter, zone scw.Zone, id string) {
+	ip, ok := a.ips[id]
+	if !ok || ip.Zone != zone {
+		writeError(w, notFound("instance_ip", id))
+		return
+	}
+
+	delete(a.ips, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createPrivateNIC handles `POST /servers/{id}/private_nics`, NICs are syncing until observed
+func (a *API) createPrivateNIC(w http.ResponseWriter, r *http.Request, zone scw.Zone, id string) {
+	s, err := a.lookup(zone, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req instance.CreatePrivateNICRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, invalid("could not decode request: %s", err))
+		return
+	}
+
+	if len(req.PrivateNetworkID) == 0 {
+		writeError(w, invalid("private_network_id is required"))
+		return
+	}
+
+	for _, nic := range s.PrivateNics {
+		if nic.PrivateNetworkID == req.PrivateNetworkID {
+			writeError(w, invalid("server is already attached to private network %s", req.PrivateNetworkID))
+			return
+		}
+	}
+
+	nic := &instance.PrivateNIC{
+		ID:               uuid(),
+		ServerID:         s.ID,
+		PrivateNetworkID: req.PrivateNetworkID,
+		MacAddress:       "02:00:00:00:00:01",
+		State:            instance.PrivateNICStateSyncing,
+		Tags:             req.Tags,
+	}
+
+	s.PrivateNics = append(s.PrivateNics, nic)
+	s.nics[nic.ID] = a.Transitions
+
+	writeJSON(w, http.StatusCreated, &instance.CreatePrivateNICResponse{PrivateNic: nic})
+}
+
+// privateNIC returns the private NIC with the given ID attached to the server, the caller must hold the lock
+func (a *API) privateNIC(zone scw.Zone, id, nicID string) (*server, *instance.PrivateNIC, *Error) {
+	s, err := a.lookup(zone, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, nic := range s.PrivateNics {
+		if nic.ID == nicID {
+			return s, nic, nil
+		}
+	}
+
+	return nil, nil, notFound("instance_private_nic", nicID)
+}
+
+// getPrivateNIC handles `GET /servers/{id}/private_nics/{nic}`
+func (a *API) getPrivateNIC(w http.ResponseWriter, zone scw.Zone, id, nicID string) {
+	s, nic, err := a.privateNIC(zone, id, nicID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if nic.State == instance.PrivateNICStateSyncing {
+		if s.nics[nic.ID] > 0 {
+			s.nics[nic.ID]--
+		} else {
+			nic.State = instance.PrivateNICStateAvailable
+		}
+	}
+
+	writeJSON(w, http.StatusOK, &instance.GetPrivateNICResponse{PrivateNic: nic})
+}
+
+// deletePrivateNIC handles `DELETE /servers/{id}/private_nics/{nic}`
+func (a *API) deletePrivateNIC(w http.ResponseWriter, zone scw.Zone, id, nicID string) {
+	s, nic, err := a.privateNIC(zone, id, nicID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	for i, n := range s.PrivateNics {
+		if n == nic {
+			s.PrivateNics = append(s.PrivateNics[:i], s.PrivateNics[i+1:]...)
+			break
+		}
+	}
+
+	delete(s.nics, nic.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// contains reports whether the slice contains the given string
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsAction reports whether the slice contains the given action
+func containsAction(s []instance.ServerAction, v instance.ServerAction) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serverTypesAvailability handles `GET /products/servers/availability`
+func (a *API) serverTypesAvailability(w http.ResponseWriter, zone scw.Zone) {
+	resp := &instance.GetServerTypesAvailabilityResponse{
+		Servers: make(map[string]*instance.GetServerTypesAvailabilityResponseAvailability),
+	}
+
+	for commercialType, availability := range a.availability[zone] {
+		resp.Servers[commercialType] = &instance.GetServerTypesAvailabilityResponseAvailability{Availability: availability}
+	}
+
+	resp.TotalCount = uint32(len(resp.Servers))
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listServersTypes handles `GET /products/servers`, only the commercial types registered with SetArch are listed
+func (a *API) listServersTypes(w http.ResponseWriter) {
+	resp := &instance.ListServersTypesResponse{Servers: make(map[string]*instance.ServerType)}
+
+	for commercialType, arch := range a.arches {
+		resp.Servers[commercialType] = &instance.ServerType{Arch: arch}
+	}
+
+	resp.TotalCount = uint32(len(resp.Servers))
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listImages handles `GET /images`, all the matching images are returned on the first page
+func (a *API) listImages(w http.ResponseWriter, r *http.Request, zone scw.Zone) {
+	query := r.URL.Query()
+
+	resp := &instance.ListImagesResponse{Images: []*instance.Image{}}
+
+	for _, image := range a.images {
+		switch {
+		case image.Zone != zone:
+		case query.Get("public") != "" && query.Get("public") != strconv.FormatBool(image.Public):
+		case query.Get("arch") != "" && query.Get("arch") != string(image.Arch):
+		case query.Get("project") != "" && query.Get("project") != image.Project:
+		case query.Get("name") != "" && !strings.Contains(image.Name, query.Get("name")):
+		case query.Get("tags") != "" && !containsAll(image.Tags, strings.Split(query.Get("tags"), ",")):
+		default:
+			c := *image
+			resp.Images = append(resp.Images, &c)
+		}
+	}
+
+	resp.TotalCount = uint32(len(resp.Images))
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listLocalImages handles `GET /marketplace/v2/local-images`, all the matching images are returned on the first page
+func (a *API) listLocalImages(w http.ResponseWriter, r *http.Request, zone scw.Zone) {
+	query := r.URL.Query()
+
+	resp := &marketplace.ListLocalImagesResponse{LocalImages: []*marketplace.LocalImage{}}
+
+	for _, image := range a.localImages {
+		switch {
+		case image.Zone != zone:
+		case query.Get("type") != "" && query.Get("type") != string(image.Type):
+		case query.Get("image_label") != "" && query.Get("image_label") != image.Label:
+		default:
+			c := *image
+			resp.LocalImages = append(resp.LocalImages, &c)
+		}
+	}
+
+	resp.TotalCount = uint32(len(resp.LocalImages))
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// containsAll reports whether the slice contains all of the given values
+func containsAll(s []string, values []string) bool {
+	for _, v := range values {
+		if !contains(s, v) {
+			return false
+		}
+	}
+
+	return true
+}
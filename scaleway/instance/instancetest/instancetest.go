@@ -0,0 +1,460 @@
+// Package instancetest provides an in-process fake of the Scaleway Instance v1 HTTP API, together with the
+// local images endpoint of the Marketplace v2 API
+package instancetest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/api/marketplace/v2"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// A set of credentials and defaults used by clients of the fake API
+const (
+	AccessKey   = "SCWXXXXXXXXXXXXXXXXX"
+	SecretKey   = "11111111-1111-1111-1111-111111111111"
+	ProjectID   = "22222222-2222-2222-2222-222222222222"
+	DefaultZone = scw.ZoneNlAms1
+)
+
+// API represents a fake Scaleway Instance API served over HTTP
+type API struct {
+	*httptest.Server
+
+	// Transitions is the number of times a server in a transitional state (e.g. `starting`) has
+	// to be observed before it settles in its final state. Zero means actions settle on the first read.
+	Transitions int
+
+	mu           sync.Mutex
+	requests     []string
+	faults       []*Fault
+	servers      map[string]*server
+	volumes      map[string]*instance.Volume
+	ips          map[string]*instance.IP
+	availability map[scw.Zone]map[string]instance.ServerTypesAvailability
+	images       map[string]*instance.Image
+	localImages  []*marketplace.LocalImage
+	arches       map[string]instance.Arch
+	sequence     int
+}
+
+// server holds the fake state of a single server instance
+type server struct {
+	*instance.Server
+	userData  map[string][]byte
+	next      instance.ServerState
+	remaining int
+	sequence  int
+	nics      map[string]int
+}
+
+// NewAPI starts and returns a new fake API, the caller should call Close when finished
+func NewAPI() *API {
+	a := &API{
+		servers:      make(map[string]*server),
+		volumes:      make(map[string]*instance.Volume),
+		ips:          make(map[string]*instance.IP),
+		availability: make(map[scw.Zone]map[string]instance.ServerTypesAvailability),
+		images:       make(map[string]*instance.Image),
+		arches:       make(map[string]instance.Arch),
+	}
+
+	a.Server = httptest.NewServer(http.HandlerFunc(a.handle))
+
+	return a
+}
+
+// Client returns a new Scaleway client that talks to the fake API, options are applied last
+func (a *API) Client(opts ...scw.ClientOption) (*scw.Client, error) {
+	return scw.NewClient(append([]scw.ClientOption{
+		scw.WithAuth(AccessKey, SecretKey),
+		scw.WithDefaultProjectID(ProjectID),
+		scw.WithDefaultZone(DefaultZone),
+		scw.WithAPIURL(a.URL),
+		scw.WithHTTPClient(a.Server.Client()),
+	}, opts...)...)
+}
+
+// Servers returns a snapshot of all the servers known to the fake API, in creation order
+func (a *API) Servers() (r []*instance.Server) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, s := range a.sorted() {
+		c := *s.Server
+		r = append(r, &c)
+	}
+
+	return r
+}
+
+// GetServer returns a snapshot of the server with the given ID or nil if not found
+func (a *API) GetServer(id string) *instance.Server {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.servers[id]
+	if !ok {
+		return nil
+	}
+
+	c := *s.Server
+
+	return &c
+}
+
+// Volumes returns a snapshot of all the volumes known to the fake API
+func (a *API) Volumes() (r []*instance.Volume) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, v := range a.volumes {
+		c := *v
+		r = append(r, &c)
+	}
+
+	return r
+}
+
+// IPs returns a snapshot of all the flexible IPs known to the fake API
+func (a *API) IPs() (r []*instance.IP) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, ip := range a.ips {
+		c := *ip
+		r = append(r, &c)
+	}
+
+	return r
+}
+
+// UserData returns the user data set on the server with the given ID
+func (a *API) UserData(id string) map[string]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.servers[id]
+	if !ok {
+		return nil
+	}
+
+	r := make(map[string]string, len(s.userData))
+	for k, v := range s.userData {
+		r[k] = string(v)
+	}
+
+	return r
+}
+
+// PrivateNICs returns a snapshot of all the private NICs attached to servers known to the fake API
+func (a *API) PrivateNICs() (r []*instance.PrivateNIC) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, s := range a.sorted() {
+		for _, nic := range s.PrivateNics {
+			c := *nic
+			r = append(r, &c)
+		}
+	}
+
+	return r
+}
+
+// SetAvailability sets the availability of a commercial type in the given zone, types in `shortage` are out of stock.
+// Types without an explicit availability are available and not reported by the availability endpoint.
+func (a *API) SetAvailability(zone scw.Zone, commercialType string, availability instance.ServerTypesAvailability) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.availability[zone] == nil {
+		a.availability[zone] = make(map[string]instance.ServerTypesAvailability)
+	}
+
+	a.availability[zone][commercialType] = availability
+}
+
+// SetArch sets the architecture of a commercial type in all zones
+func (a *API) SetArch(commercialType string, arch instance.Arch) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.arches[commercialType] = arch
+}
+
+// AddImage adds an image directly to the fake state, images are private images of the default project by default
+func (a *API) AddImage(image *instance.Image) *instance.Image {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(image.ID) == 0 {
+		image.ID = uuid()
+	}
+
+	if len(image.Zone) == 0 {
+		image.Zone = DefaultZone
+	}
+
+	if len(image.Project) == 0 {
+		image.Project = ProjectID
+	}
+
+	if len(image.Arch) == 0 {
+		image.Arch = instance.ArchX86_64
+	}
+
+	if len(image.State) == 0 {
+		image.State = instance.ImageStateAvailable
+	}
+
+	if image.CreationDate == nil {
+		now := time.Now()
+		image.CreationDate = &now
+	}
+
+	c := *image
+	a.images[image.ID] = &c
+
+	return image
+}
+
+// AddLocalImage adds a marketplace local image directly to the fake state
+func (a *API) AddLocalImage(image *marketplace.LocalImage) *marketplace.LocalImage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(image.ID) == 0 {
+		image.ID = uuid()
+	}
+
+	if len(image.Zone) == 0 {
+		image.Zone = DefaultZone
+	}
+
+	if len(image.Type) == 0 {
+		image.Type = marketplace.LocalImageTypeInstanceLocal
+	}
+
+	c := *image
+	a.localImages = append(a.localImages, &c)
+
+	return image
+}
+
+// AddServer adds a server directly to the fake state, bypassing the HTTP API
+func (a *API) AddServer(srv *instance.Server) *instance.Server {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(srv.ID) == 0 {
+		srv.ID = uuid()
+	}
+
+	if len(srv.Zone) == 0 {
+		srv.Zone = DefaultZone
+	}
+
+	if len(srv.State) == 0 {
+		srv.State = instance.ServerStateRunning
+	}
+
+	if srv.AllowedActions == nil {
+		srv.AllowedActions = allowedActions(srv.State)
+	}
+
+	if srv.CreationDate == nil {
+		now := time.Now()
+		srv.CreationDate = &now
+	}
+
+	a.add(srv)
+
+	c := *srv
+
+	return &c
+}
+
+// add registers the given server in the fake state, the caller must hold the lock
+func (a *API) add(srv *instance.Server) {
+	a.sequence++
+	a.servers[srv.ID] = &server{Server: srv, userData: make(map[string][]byte), sequence: a.sequence,
+		nics: make(map[string]int)}
+}
+
+// sorted returns the servers in creation order, the caller must hold the lock
+func (a *API) sorted() []*server {
+	r := make([]*server, 0, len(a.servers))
+	for _, s := range a.servers {
+		r = append(r, s)
+	}
+
+	sort.Slice(r, func(i, j int) bool { return r[i].sequence < r[j].sequence })
+
+	return r
+}
+
+// observe advances the state machine of the given server, the caller must hold the lock
+func (a *API) observe(s *server) {
+	if len(s.next) == 0 {
+		return
+	}
+
+	if s.remaining > 0 {
+		s.remaining--
+		return
+	}
+
+	s.State, s.next = s.next, ""
+	s.StateDetail = string(s.State)
+	s.AllowedActions = allowedActions(s.State)
+	s.modified()
+}
+
+// transition moves the given server into a transitional state, the caller must hold the lock
+func (a *API) transition(s *server, via, to instance.ServerState) {
+	s.State, s.next, s.remaining = via, to, a.Transitions
+	s.StateDetail = string(via)
+	s.AllowedActions = allowedActions(via)
+	s.modified()
+}
+
+// modified updates the modification date of the server, the caller must hold the lock
+func (s *server) modified() {
+	now := time.Now()
+	s.ModificationDate = &now
+}
+
+// allowedActions returns the actions that can be performed in the given state
+func allowedActions(state instance.ServerState) []instance.ServerAction {
+	switch state {
+	case instance.ServerStateRunning:
+		return []instance.ServerAction{instance.ServerActionPoweroff, instance.ServerActionStopInPlace,
+			instance.ServerActionReboot, instance.ServerActionTerminate}
+	case instance.ServerStateStopped:
+		return []instance.ServerAction{instance.ServerActionPoweron, instance.ServerActionTerminate}
+	case instance.ServerStateStoppedInPlace:
+		return []instance.ServerAction{instance.ServerActionPoweron, instance.ServerActionPoweroff,
+			instance.ServerActionTerminate}
+	}
+
+	return nil
+}
+
+// Requests returns the number of requests received that match the method and path pattern, see `Fault`
+func (a *API) Requests(method, path string) (n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pattern := append([]string{method}, strings.Split(path, "/")...)
+
+	for _, r := range a.requests {
+		if match(strings.Split(r, "/"), pattern...) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Fault represents an error injected into the fake API for matching requests
+type Fault struct {
+	// Method is the HTTP method to match
+	Method string
+
+	// Path is the request path relative to the zone, `*` matches any single segment (e.g. `servers/*/action`)
+	Path string
+
+	// Count is the number of times the fault is injected, zero injects it indefinitely
+	Count int
+
+	// Err is the error returned to the client
+	Err *Error
+}
+
+// Inject registers a fault that is returned instead of the regular response for matching requests
+func (a *API) Inject(f Fault) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.faults = append(a.faults, &f)
+}
+
+// fault returns the first fault matching the request and consumes it, the caller must hold the lock
+func (a *API) fault(method string, parts []string) *Error {
+	for i, f := range a.faults {
+		if f.Method != method || !match(parts, strings.Split(f.Path, "/")...) {
+			continue
+		}
+
+		if f.Count > 0 {
+			if f.Count--; f.Count == 0 {
+				a.faults = append(a.faults[:i], a.faults[i+1:]...)
+			}
+		}
+
+		return f.Err
+	}
+
+	return nil
+}
+
+// Error represents an error response as returned by the Instance API
+type Error struct {
+	Status     int    `json:"-"`
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+	Resource   string `json:"resource,omitempty"`
+	ResourceID string `json:"resource_id,omitempty"`
+
+	// Header holds additional response headers, e.g. `Retry-After`
+	Header http.Header `json:"-"`
+}
+
+// notFound returns a `not_found` error for the given resource
+func notFound(resource, id string) *Error {
+	return &Error{Status: http.StatusNotFound, Type: "not_found", Message: fmt.Sprintf("%s not found", resource),
+		Resource: resource, ResourceID: id}
+}
+
+// invalid returns an `invalid_request_error` error with the given message
+func invalid(format string, a ...interface{}) *Error {
+	return &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Message: fmt.Sprintf(format, a...)}
+}
+
+// writeJSON writes the given value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the given error as a JSON response
+func writeError(w http.ResponseWriter, err *Error) {
+	for key, values := range err.Header {
+		w.Header()[key] = values
+	}
+
+	writeJSON(w, err.Status, err)
+}
+
+// uuid returns a random version 4 UUID
+func uuid() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,20 @@
+package instance
+
+import (
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// observe records the latency of an API call and counts its errors, labelled by endpoint and zone.
+// The error is passed by reference so that it can be deferred before the call returns.
+func observe(endpoint string, zone scw.Zone, start time.Time, err *error) {
+	labels := []metrics.Label{{Name: "endpoint", Value: endpoint}, {Name: "zone", Value: string(zone)}}
+
+	metrics.MeasureSinceWithLabels([]string{"scaleway", "api", "latency"}, start, labels)
+
+	if *err != nil {
+		metrics.IncrCounterWithLabels([]string{"scaleway", "api", "errors"}, 1, labels)
+	}
+}
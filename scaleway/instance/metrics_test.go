@@ -0,0 +1,62 @@
+package instance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/armon/go-metrics"
+
+	"github.com/karelorigin/nomad-scaleway-target/scaleway/instance/instancetest"
+)
+
+// TestObserve tests that API calls emit their latency and errors by endpoint
+func TestObserve(t *testing.T) {
+	config := metrics.DefaultConfig("test")
+	config.EnableHostname = false
+	config.EnableRuntimeMetrics = false
+
+	sink := metrics.NewInmemSink(time.Hour, time.Hour)
+	if _, err := metrics.NewGlobal(config, sink); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = metrics.NewGlobal(config, &metrics.BlackholeSink{})
+	})
+
+	api, fake := NewTestAPI(t)
+	fake.Inject(instancetest.Fault{Method: http.MethodGet, Path: "servers", Count: 1,
+		Err: &instancetest.Error{Status: http.StatusInternalServerError, Type: "internal_error", Message: "boom"}})
+
+	server, err := NewTestServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.ListServersAll(context.Background(), server)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	_, err = api.ListServersAll(context.Background(), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := sink.Data()
+	data[0].RLock()
+	defer data[0].RUnlock()
+
+	key := "test.scaleway.api.%s;endpoint=list_servers;zone=" + string(server.Zone)
+
+	if counter, ok := data[0].Counters[fmt.Sprintf(key, "errors")]; !ok || counter.Count != 1 {
+		t.Errorf("Expected 1 list_servers error, got %v", data[0].Counters)
+	}
+
+	if sample, ok := data[0].Samples[fmt.Sprintf(key, "latency")]; !ok || sample.Count != 2 {
+		t.Errorf("Expected 2 list_servers latencies, got %v", data[0].Samples)
+	}
+}
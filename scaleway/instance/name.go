@@ -0,0 +1,117 @@
+package instance
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// alphabet is the set of characters used for random name segments, valid in hostnames
+const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// NameTemplate represents a server name template, e.g. `nomad-client-{{zone}}-{{random 6}}`
+type NameTemplate string
+
+// IsTemplate returns whether the name contains template actions
+func (n NameTemplate) IsTemplate() bool {
+	return strings.Contains(string(n), "{{")
+}
+
+// Validate returns an error if the template cannot be parsed
+func (n NameTemplate) Validate() error {
+	_, err := n.parse("", 0)
+	return err
+}
+
+// Render renders the template for the server with the given zone and index
+func (n NameTemplate) Render(zone scw.Zone, index int) (string, error) {
+	tmpl, err := n.parse(zone, index)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	err = tmpl.Execute(&b, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// parse parses the template with the template functions bound to the given zone and index
+func (n NameTemplate) parse(zone scw.Zone, index int) (*template.Template, error) {
+	return template.New("name").Funcs(template.FuncMap{
+		"zone":   func() string { return string(zone) },
+		"index":  func() int { return index },
+		"random": random,
+	}).Parse(string(n))
+}
+
+// random returns a random string of length n
+func random(n int) (string, error) {
+	b := make([]byte, n)
+
+	for i := range b {
+		r, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+
+		b[i] = alphabet[r.Int64()]
+	}
+
+	return string(b), nil
+}
+
+// Namer renders unique server names from a template
+type Namer struct {
+	mu       sync.Mutex
+	template NameTemplate
+	taken    map[string]bool
+	index    int
+}
+
+// NewNamer returns a new namer that avoids the names of the given servers
+func NewNamer(template NameTemplate, servers Servers) *Namer {
+	taken := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		taken[server.Name] = true
+	}
+
+	return &Namer{
+		template: template,
+		taken:    taken,
+	}
+}
+
+// Next returns the next unique name for a server in the given zone
+func (n *Namer) Next(zone scw.Zone) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Indices are tried in order, so every taken name costs at most one attempt
+	attempts := len(n.taken) + 16
+
+	for i := 0; i < attempts; i++ {
+		name, err := n.template.Render(zone, n.index)
+		if err != nil {
+			return "", err
+		}
+
+		n.index++
+
+		if !n.taken[name] {
+			n.taken[name] = true
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("could not render a unique name from template '%s' after %d attempts", n.template, attempts)
+}
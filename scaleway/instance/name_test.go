@@ -0,0 +1,51 @@
+package instance
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// TestNameTemplateRender tests rendering name templates
+func TestNameTemplateRender(t *testing.T) {
+	name, err := NameTemplate("nomad-client-{{zone}}-{{index}}-{{random 6}}").Render(scw.ZoneFrPar1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^nomad-client-fr-par-1-3-[a-z0-9]{6}$`).MatchString(name) {
+		t.Errorf("Unexpected name %q", name)
+	}
+
+	if NameTemplate("nomad-{{random").Validate() == nil {
+		t.Error("Expected an error for a malformed template")
+	}
+}
+
+// TestNamer tests that the namer skips names that are already taken
+func TestNamer(t *testing.T) {
+	namer := NewNamer("nomad-{{index}}", Servers{{Name: "nomad-0"}, {Name: "nomad-2"}})
+
+	for _, expected := range []string{"nomad-1", "nomad-3", "nomad-4"} {
+		name, err := namer.Next(scw.ZoneFrPar1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name != expected {
+			t.Errorf("Expected name %s, got %s", expected, name)
+		}
+	}
+
+	// A template without variable parts can only be rendered once
+	namer = NewNamer("nomad", nil)
+
+	if _, err := namer.Next(scw.ZoneFrPar1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := namer.Next(scw.ZoneFrPar1); err == nil {
+		t.Error("Expected an error when no unique name can be rendered")
+	}
+}
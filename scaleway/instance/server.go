@@ -1,27 +1,39 @@
 package instance
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/karelorigin/nomad-scaleway-target/types"
 	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
-	"github.com/scaleway/scaleway-sdk-go/scw"
 )
 
 // Server is a convenience type for performing operations on a Scaleway server instance
 type Server instance.Server
 
+// ServerStates are all the states a server can be in
+var ServerStates = []instance.ServerState{
+	instance.ServerStateRunning,
+	instance.ServerStateStopped,
+	instance.ServerStateStoppedInPlace,
+	instance.ServerStateStarting,
+	instance.ServerStateStopping,
+	instance.ServerStateLocked,
+}
+
+// DefaultTags are the tags of every server managed by the autoscaler, in addition to the tags of the policy
+var DefaultTags = []string{"nomad", "client", "autoscaler"}
+
 // Decode decodes a map of strings into a server instance
 func (s *Server) Decode(config map[string]string) error {
 	var shadow struct {
 		Name           string            `mapstructure:"name"`
 		Tags           types.SliceString `mapstructure:"tags"`
-		Zone           string            `mapstructure:"zone"`
 		DynamicIP      types.Bool        `mapstructure:"dynamic_ip"`
 		RoutedIP       types.Bool        `mapstructure:"routed_ip"`
-		CommercialType string            `mapstructure:"commercial_type"`
 		Image          *string           `mapstructure:"image"`
 		EnableIPv6     types.Bool        `mapstructure:"enable_ipv6"`
 		SecurityGroup  *string           `mapstructure:"security_group"`
@@ -40,21 +52,60 @@ func (s *Server) Decode(config map[string]string) error {
 		return err
 	}
 
-	zone, err := scw.ParseZone(shadow.Zone)
+	// Multi-zone pools use their first zone as the default
+	var zones Zones
+	err = zones.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	var commercialTypes CommercialTypes
+	err = commercialTypes.Decode(config)
 	if err != nil {
 		return err
 	}
 
 	*s = Server(instance.Server{
-		Name:              shadow.Name,
-		Zone:              zone,
 		DynamicIPRequired: bool(shadow.DynamicIP),
 		RoutedIPEnabled:   bool(shadow.RoutedIP),
-		CommercialType:    shadow.CommercialType,
-		Tags:              append([]string{"nomad", "client", "autoscaler"}, shadow.Tags...),
+		Tags:              append(append([]string{}, DefaultTags...), shadow.Tags...),
 		EnableIPv6:        bool(shadow.EnableIPv6),
 	})
 
+	var volumes Volumes
+	err = volumes.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	// Add volumes if set, the root volume is created from the image otherwise
+	for key, volume := range volumes.Keys() {
+		if s.Volumes == nil {
+			s.Volumes = make(map[string]*instance.VolumeServer)
+		}
+
+		s.Volumes[key] = &instance.VolumeServer{
+			Size:       volume.Size,
+			VolumeType: instance.VolumeServerVolumeType(volume.Type),
+			Boot:       key == "0",
+		}
+	}
+
+	// Pools without a zone are left to the default zone of the client
+	if len(zones) > 0 {
+		s.Zone = zones[0]
+	}
+
+	// Pools with fallback types cannot be identified by a single commercial type
+	if len(commercialTypes) == 1 {
+		s.CommercialType = commercialTypes[0]
+	}
+
+	// Templated names are rendered per server, so they cannot be used to identify the pool
+	if !NameTemplate(shadow.Name).IsTemplate() {
+		s.Name = shadow.Name
+	}
+
 	// Add instance image if set
 	if shadow.Image != nil {
 		s.Image = &instance.Image{ID: *shadow.Image}
@@ -91,6 +142,11 @@ func (s *Server) CreateServerRequest() *instance.CreateServerRequest {
 		req.Image = s.Image.ID
 	}
 
+	// Add volume templates if set
+	for key, volume := range s.Volumes {
+		req.Volumes[key] = (&Volume{Size: volume.Size, Type: instance.VolumeVolumeType(volume.VolumeType)}).Template()
+	}
+
 	// Add security group ID if set
 	if s.SecurityGroup != nil {
 		req.SecurityGroup = &s.SecurityGroup.ID
@@ -139,6 +195,7 @@ func (s *Server) ListServersRequest() *instance.ListServersRequest {
 func (s *Server) ActionAndWaitRequest(action instance.ServerAction, timeout time.Duration) *instance.ServerActionAndWaitRequest {
 	return &instance.ServerActionAndWaitRequest{
 		ServerID: s.ID,
+		Zone:     s.Zone,
 		Action:   action,
 		Timeout:  &timeout,
 	}
@@ -154,13 +211,29 @@ func (s *Server) DeleteServerRequest() *instance.DeleteServerRequest {
 
 // ServerOpt represents a server-related options
 type ServerOpt struct {
-	UserData types.MapString `mapstructure:"user_data"`
+	Name              NameTemplate      `mapstructure:"name"`
+	UserData          types.MapString   `mapstructure:"user_data"`
+	CheckAvailability types.Bool        `mapstructure:"check_availability"`
+	PrivateNetworks   types.SliceString `mapstructure:"private_networks"`
+	Timeouts          `mapstructure:",squash"`
+
+	// Images resolves image references that are not image IDs, they are passed on as is if not set
+	Images *Images `mapstructure:"-"`
+}
+
+// timeouts returns the timeouts of the options, the options can be nil
+func (s *ServerOpt) timeouts() *Timeouts {
+	if s == nil {
+		return nil
+	}
+
+	return &s.Timeouts
 }
 
 // Decode decodes a map of strings into a server options instance
 func (s *ServerOpt) Decode(config map[string]string) error {
-	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: mapstructure.TextUnmarshallerHookFunc(),
-		Result: s})
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: mapstructure.ComposeDecodeHookFunc(
+		mapstructure.TextUnmarshallerHookFunc(), mapstructure.StringToTimeDurationHookFunc()), Result: s})
 	if err != nil {
 		return err
 	}
@@ -170,6 +243,12 @@ func (s *ServerOpt) Decode(config map[string]string) error {
 		return err
 	}
 
+	if s.Name.IsTemplate() {
+		if err := s.Name.Validate(); err != nil {
+			return fmt.Errorf("invalid name template: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -212,6 +291,19 @@ func (s Servers) IDs() (ids []string) {
 	return ids
 }
 
+// WithoutIDs filters the slice into a subslice of servers without the given IDs
+func (s Servers) WithoutIDs(ids ...string) (r Servers) {
+	excluded := s.WithIDs(ids...)
+
+	for _, server := range s {
+		if excluded.WithID(server.ID) == nil {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
 // WithIDs filters the slice into a subslice of servers with matching IDs
 func (s Servers) WithIDs(ids ...string) (r Servers) {
 	for _, id := range ids {
@@ -244,3 +336,132 @@ func (s Servers) WithName(name string) *Server {
 
 	return nil
 }
+
+// WithIP returns a server that has the given private or public IP address or nil if not found
+func (s Servers) WithIP(ip string) *Server {
+	for _, server := range s {
+		for _, addr := range server.IPs() {
+			if addr == ip {
+				return server
+			}
+		}
+	}
+
+	return nil
+}
+
+// AllWithIP returns all the servers that have the given private or public IP address
+func (s Servers) AllWithIP(ip string) (r Servers) {
+	for _, server := range s {
+		for _, addr := range server.IPs() {
+			if addr == ip {
+				r = append(r, server)
+				break
+			}
+		}
+	}
+
+	return r
+}
+
+// AllWithName returns all the servers with the given name
+func (s Servers) AllWithName(name string) (r Servers) {
+	for _, server := range s {
+		if server.Name == name {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// Matching filters the slice into a subslice of servers that would be listed for the given blueprint
+func (s Servers) Matching(blueprint Server) (r Servers) {
+	for _, server := range s {
+		if server.Matches(blueprint) {
+			r = append(r, server)
+		}
+	}
+
+	return r
+}
+
+// Matches returns whether the server would be listed for the given blueprint, see `ListServersRequest`
+func (s *Server) Matches(blueprint Server) bool {
+	if len(blueprint.Name) > 0 && !strings.Contains(s.Name, blueprint.Name) {
+		return false
+	}
+
+	if len(blueprint.Zone) > 0 && s.Zone != blueprint.Zone {
+		return false
+	}
+
+	if len(blueprint.CommercialType) > 0 && s.CommercialType != blueprint.CommercialType {
+		return false
+	}
+
+	for _, tag := range blueprint.Tags {
+		if !s.HasTag(tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HasTag returns whether the server has the given tag
+func (s *Server) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TagsWithout returns the tags of the server except the given ones, never nil
+func (s *Server) TagsWithout(tags ...string) []string {
+	r := []string{}
+
+	for _, t := range s.Tags {
+		if !(&Server{Tags: tags}).HasTag(t) {
+			r = append(r, t)
+		}
+	}
+
+	return r
+}
+
+// Stopped returns whether the server is stopped, with or without its resources
+func (s *Server) Stopped() bool {
+	return s.State == instance.ServerStateStopped || s.State == instance.ServerStateStoppedInPlace
+}
+
+// Locked returns whether the server is locked by Scaleway, locked servers cannot be powered off or deleted
+func (s *Server) Locked() bool {
+	return s.State == instance.ServerStateLocked
+}
+
+// IPs returns all the private and public IP addresses of the server
+func (s *Server) IPs() (ips []string) {
+	if s.PrivateIP != nil {
+		ips = append(ips, *s.PrivateIP)
+	}
+
+	if s.PublicIP != nil && s.PublicIP.Address != nil {
+		ips = append(ips, s.PublicIP.Address.String())
+	}
+
+	for _, ip := range s.PublicIPs {
+		if ip.Address != nil {
+			ips = append(ips, ip.Address.String())
+		}
+	}
+
+	if s.IPv6 != nil && s.IPv6.Address != nil {
+		ips = append(ips, s.IPv6.Address.String())
+	}
+
+	return ips
+}
@@ -0,0 +1,32 @@
+package instance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// TestActionAndWaitRequest tests that server actions are sent to the zone of the server
+func TestActionAndWaitRequest(t *testing.T) {
+	api, fake := NewTestAPI(t)
+
+	// The server is outside of the default zone of the client
+	created := fake.AddServer(&instance.Server{Zone: scw.ZoneFrPar1, Name: "action", State: instance.ServerStateStopped})
+	server := Server(*created)
+
+	req := server.ActionAndWaitRequest(instance.ServerActionPoweron, time.Minute)
+	if req.Zone != scw.ZoneFrPar1 {
+		t.Errorf("Expected the request zone to be %s, got %s", scw.ZoneFrPar1, req.Zone)
+	}
+
+	err := api.Native().ServerActionAndWait(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state := fake.GetServer(created.ID).State; state != instance.ServerStateRunning {
+		t.Errorf("Expected the server to be running, got %s", state)
+	}
+}
@@ -0,0 +1,54 @@
+package instance
+
+import (
+	"time"
+)
+
+// A set of default timeouts
+const (
+	DefaultScaleTimeout      = time.Hour
+	DefaultPowerOnTimeout    = time.Minute * 3
+	DefaultPowerOffTimeout   = time.Minute * 5
+	DefaultPrivateNICTimeout = time.Minute * 2
+)
+
+// Timeouts represents the timeouts of a scaling action and the server actions within it, zero values use the defaults
+type Timeouts struct {
+	Scale      time.Duration `mapstructure:"scale_timeout"`
+	PowerOn    time.Duration `mapstructure:"power_on_timeout"`
+	PowerOff   time.Duration `mapstructure:"power_off_timeout"`
+	PrivateNIC time.Duration `mapstructure:"private_nic_timeout"`
+}
+
+// ScaleTimeout returns the timeout of a whole scaling action
+func (t *Timeouts) ScaleTimeout() time.Duration {
+	return t.or(func(t *Timeouts) time.Duration { return t.Scale }, DefaultScaleTimeout)
+}
+
+// PowerOnTimeout returns the timeout for powering on a server
+func (t *Timeouts) PowerOnTimeout() time.Duration {
+	return t.or(func(t *Timeouts) time.Duration { return t.PowerOn }, DefaultPowerOnTimeout)
+}
+
+// PowerOffTimeout returns the timeout for powering off a server
+func (t *Timeouts) PowerOffTimeout() time.Duration {
+	return t.or(func(t *Timeouts) time.Duration { return t.PowerOff }, DefaultPowerOffTimeout)
+}
+
+// PrivateNICTimeout returns the timeout for a private NIC to become ready
+func (t *Timeouts) PrivateNICTimeout() time.Duration {
+	return t.or(func(t *Timeouts) time.Duration { return t.PrivateNIC }, DefaultPrivateNICTimeout)
+}
+
+// or returns the timeout selected by fn, or the default if the timeouts are nil or the timeout is not set
+func (t *Timeouts) or(fn func(t *Timeouts) time.Duration, def time.Duration) time.Duration {
+	if t == nil {
+		return def
+	}
+
+	if d := fn(t); d > 0 {
+		return d
+	}
+
+	return def
+}
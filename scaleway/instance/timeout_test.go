@@ -0,0 +1,40 @@
+package instance
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTimeouts tests decoding timeouts and falling back to the defaults
+func TestTimeouts(t *testing.T) {
+	var opt ServerOpt
+	err := opt.Decode(map[string]string{
+		"scale_timeout":    "30m",
+		"power_on_timeout": "90s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := opt.Timeouts.ScaleTimeout(); d != time.Minute*30 {
+		t.Errorf("Expected a scale timeout of 30m, got %s", d)
+	}
+
+	if d := opt.Timeouts.PowerOnTimeout(); d != time.Second*90 {
+		t.Errorf("Expected a power on timeout of 90s, got %s", d)
+	}
+
+	if d := opt.Timeouts.PowerOffTimeout(); d != DefaultPowerOffTimeout {
+		t.Errorf("Expected the default power off timeout, got %s", d)
+	}
+
+	var timeouts *Timeouts
+	if d := timeouts.PrivateNICTimeout(); d != DefaultPrivateNICTimeout {
+		t.Errorf("Expected nil timeouts to use the default, got %s", d)
+	}
+
+	err = opt.Decode(map[string]string{"power_off_timeout": "soon"})
+	if err == nil {
+		t.Error("Expected an invalid duration to fail decoding")
+	}
+}
@@ -0,0 +1,189 @@
+package instance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// Volume represents a volume of the server blueprint
+type Volume struct {
+	Size scw.Size
+	Type instance.VolumeVolumeType
+	Keep bool
+}
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface, the format is `size[:type[:keep]]` with the size in GB
+func (v *Volume) UnmarshalText(text []byte) (err error) {
+	parts := strings.Split(strings.TrimSpace(string(text)), ":")
+	if len(parts) > 3 {
+		return fmt.Errorf("invalid volume '%s', expected size[:type[:keep]]", text)
+	}
+
+	r := Volume{}
+
+	r.Size, err = ParseVolumeSize(parts[0])
+	if err != nil {
+		return err
+	}
+
+	if len(parts) > 1 {
+		r.Type, err = ParseVolumeType(parts[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(parts) > 2 {
+		if parts[2] != "keep" {
+			return fmt.Errorf("invalid volume flag '%s', expected keep", parts[2])
+		}
+
+		r.Keep = true
+	}
+
+	*v = r
+
+	return nil
+}
+
+// Template returns the volume template used in create requests
+func (v *Volume) Template() *instance.VolumeServerTemplate {
+	tmpl := &instance.VolumeServerTemplate{
+		VolumeType: v.Type,
+	}
+
+	if v.Size > 0 {
+		tmpl.Size = &v.Size
+	}
+
+	return tmpl
+}
+
+// ParseVolumeSize parses a volume size in GB
+func ParseVolumeSize(s string) (scw.Size, error) {
+	gb, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil || gb == 0 {
+		return 0, fmt.Errorf("invalid volume size '%s', expected a positive number of GB", s)
+	}
+
+	return scw.Size(gb) * scw.GB, nil
+}
+
+// ParseVolumeType parses a volume type, one of `l_ssd`, `b_ssd` or `sbs`
+func ParseVolumeType(s string) (instance.VolumeVolumeType, error) {
+	switch strings.TrimSpace(s) {
+	case "l_ssd":
+		return instance.VolumeVolumeTypeLSSD, nil
+	case "b_ssd":
+		return instance.VolumeVolumeTypeBSSD, nil
+	case "sbs", "sbs_volume":
+		return instance.VolumeVolumeTypeSbsVolume, nil
+	}
+
+	return "", fmt.Errorf("invalid volume type '%s', expected l_ssd, b_ssd or sbs", s)
+}
+
+// DataVolumes represents the list of data volumes attached to every server in addition to the root volume
+type DataVolumes []Volume
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface, volumes are comma-separated
+func (d *DataVolumes) UnmarshalText(text []byte) error {
+	r := DataVolumes{}
+
+	for _, spec := range strings.Split(string(text), ",") {
+		if len(strings.TrimSpace(spec)) == 0 {
+			continue
+		}
+
+		var v Volume
+		if err := v.UnmarshalText([]byte(spec)); err != nil {
+			return err
+		}
+
+		r = append(r, v)
+	}
+
+	*d = r
+
+	return nil
+}
+
+// Volumes represents the root and data volumes of the server blueprint
+type Volumes struct {
+	Root *Volume
+	Data DataVolumes
+}
+
+// Decode decodes the volume keys from a map of strings
+func (v *Volumes) Decode(config map[string]string) error {
+	var shadow struct {
+		RootVolumeSize string      `mapstructure:"root_volume_size"`
+		RootVolumeType string      `mapstructure:"root_volume_type"`
+		DataVolumes    DataVolumes `mapstructure:"data_volumes"`
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: mapstructure.TextUnmarshallerHookFunc(),
+		Result: &shadow})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	r := Volumes{Data: shadow.DataVolumes}
+
+	if len(shadow.RootVolumeSize) > 0 || len(shadow.RootVolumeType) > 0 {
+		r.Root = &Volume{}
+
+		if len(shadow.RootVolumeSize) > 0 {
+			if r.Root.Size, err = ParseVolumeSize(shadow.RootVolumeSize); err != nil {
+				return err
+			}
+		}
+
+		if len(shadow.RootVolumeType) > 0 {
+			if r.Root.Type, err = ParseVolumeType(shadow.RootVolumeType); err != nil {
+				return err
+			}
+		}
+	}
+
+	*v = r
+
+	return nil
+}
+
+// Keys returns the volume template keys mapped to their volumes, the root volume has key `0`
+func (v *Volumes) Keys() map[string]*Volume {
+	keys := make(map[string]*Volume)
+
+	if v.Root != nil {
+		keys["0"] = v.Root
+	}
+
+	for i := range v.Data {
+		keys[strconv.Itoa(i+1)] = &v.Data[i]
+	}
+
+	return keys
+}
+
+// Kept returns the keys of the data volumes that are kept when servers are removed
+func (v *Volumes) Kept() (keys []string) {
+	for i, volume := range v.Data {
+		if volume.Keep {
+			keys = append(keys, strconv.Itoa(i+1))
+		}
+	}
+
+	return keys
+}
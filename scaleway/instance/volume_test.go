@@ -0,0 +1,48 @@
+package instance
+
+import (
+	"testing"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// TestVolumesDecode tests decoding the root and data volumes
+func TestVolumesDecode(t *testing.T) {
+	var volumes Volumes
+
+	err := volumes.Decode(map[string]string{
+		"root_volume_size": "40",
+		"root_volume_type": "b_ssd",
+		"data_volumes":     "50:sbs:keep, 100",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if volumes.Root == nil || volumes.Root.Size != 40*scw.GB || volumes.Root.Type != instance.VolumeVolumeTypeBSSD {
+		t.Errorf("Expected a 40GB b_ssd root volume, got %+v", volumes.Root)
+	}
+
+	if len(volumes.Data) != 2 {
+		t.Fatalf("Expected 2 data volumes, got %d", len(volumes.Data))
+	}
+
+	if v := volumes.Data[0]; v.Size != 50*scw.GB || v.Type != instance.VolumeVolumeTypeSbsVolume || !v.Keep {
+		t.Errorf("Expected a kept 50GB sbs volume, got %+v", v)
+	}
+
+	if v := volumes.Data[1]; v.Size != 100*scw.GB || len(v.Type) != 0 || v.Keep {
+		t.Errorf("Expected a 100GB volume, got %+v", v)
+	}
+
+	if kept := volumes.Kept(); len(kept) != 1 || kept[0] != "1" {
+		t.Errorf("Expected volume 1 to be kept, got %v", kept)
+	}
+
+	for _, spec := range []string{"0", "ten", "10:nvme", "10:l_ssd:forever", "10:l_ssd:keep:1"} {
+		if err := volumes.Decode(map[string]string{"data_volumes": spec}); err == nil {
+			t.Errorf("Expected an error for volume '%s'", spec)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package instance
+
+import (
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/karelorigin/nomad-scaleway-target/types"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// Zones represents the ordered set of zones a server pool is spread over
+type Zones []scw.Zone
+
+// Decode decodes the `zones` list from a map of strings, falling back to the single `zone`. The zones are left
+// empty if neither is set, the default zone of the client applies then.
+func (z *Zones) Decode(config map[string]string) error {
+	var shadow struct {
+		Zone  string            `mapstructure:"zone"`
+		Zones types.SliceString `mapstructure:"zones"`
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: mapstructure.TextUnmarshallerHookFunc(),
+		Result: &shadow})
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	names := shadow.Zones
+	if len(names) == 0 && len(shadow.Zone) > 0 {
+		names = []string{shadow.Zone}
+	}
+
+	zones := Zones{}
+
+	for _, name := range names {
+		zone, err := scw.ParseZone(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+
+		if !zones.Contains(zone) {
+			zones = append(zones, zone)
+		}
+	}
+
+	*z = zones
+
+	return nil
+}
+
+// Contains returns whether the given zone is part of the set
+func (z Zones) Contains(zone scw.Zone) bool {
+	for _, s := range z {
+		if s == zone {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Counts returns the amount of servers in each of the zones
+func (z Zones) Counts(servers Servers) map[scw.Zone]int {
+	counts := make(map[scw.Zone]int, len(z))
+	for _, zone := range z {
+		counts[zone] = 0
+	}
+
+	for _, server := range servers {
+		if _, ok := counts[server.Zone]; ok {
+			counts[server.Zone]++
+		}
+	}
+
+	return counts
+}
+
+// Spread returns the zones to create `n` new servers in, keeping the per-zone counts of the pool balanced.
+// Ties are broken in favour of the zone listed first.
+func (z Zones) Spread(servers Servers, n int) []scw.Zone {
+	counts := z.Counts(servers)
+	spread := make([]scw.Zone, n)
+
+	for i := range spread {
+		least := z[0]
+		for _, zone := range z[1:] {
+			if counts[zone] < counts[least] {
+				least = zone
+			}
+		}
+
+		counts[least]++
+		spread[i] = least
+	}
+
+	return spread
+}
+
+// Trim returns the amount of servers to remove from each zone to shrink the pool by `n` servers,
+// taking from the most over-represented zone first. Ties are broken in favour of the zone listed last.
+func (z Zones) Trim(servers Servers, n int) map[scw.Zone]int {
+	trim, _ := z.TrimWithin(servers, z.Counts(servers), n)
+	return trim
+}
+
+// TrimWithin is like Trim but removes at most `available` servers from each zone, e.g. because the other servers
+// cannot be removed. Zones that run out are skipped in favour of the next most over-represented zone, the number of
+// servers that could not be removed from any zone is returned too.
+func (z Zones) TrimWithin(servers Servers, available map[scw.Zone]int, n int) (trim map[scw.Zone]int, short int) {
+	counts := z.Counts(servers)
+	trim = make(map[scw.Zone]int)
+
+	for i := 0; i < n; i++ {
+		var most scw.Zone
+		for j := len(z) - 1; j >= 0; j-- {
+			if trim[z[j]] >= available[z[j]] {
+				continue
+			}
+
+			if len(most) == 0 || counts[z[j]] > counts[most] {
+				most = z[j]
+			}
+		}
+
+		// Every zone ran out of servers that can be removed
+		if len(most) == 0 {
+			return trim, n - i
+		}
+
+		counts[most]--
+		trim[most]++
+	}
+
+	return trim, 0
+}
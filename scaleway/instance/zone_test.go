@@ -0,0 +1,109 @@
+package instance
+
+import (
+	"testing"
+
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// TestZonesDecode tests decoding the zones list and the single zone fallback
+func TestZonesDecode(t *testing.T) {
+	var zones Zones
+
+	err := zones.Decode(map[string]string{"zone": "nl-ams-1", "zones": "fr-par-1, fr-par-2,fr-par-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(zones) != 2 || zones[0] != scw.ZoneFrPar1 || zones[1] != scw.ZoneFrPar2 {
+		t.Errorf("Expected [fr-par-1 fr-par-2], got %v", zones)
+	}
+
+	err = zones.Decode(map[string]string{"zone": "nl-ams-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(zones) != 1 || zones[0] != scw.ZoneNlAms1 {
+		t.Errorf("Expected [nl-ams-1], got %v", zones)
+	}
+
+	if err := zones.Decode(map[string]string{"zones": "fr-par-1,mars-1"}); err == nil {
+		t.Error("Expected an error for an unknown zone")
+	}
+}
+
+// TestZonesDecodeDefault tests that policies without a zone are left to the default zone of the client
+func TestZonesDecodeDefault(t *testing.T) {
+	var zones Zones
+
+	err := zones.Decode(map[string]string{"image": "x", "commercial_type": "DEV1-S"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(zones) != 0 {
+		t.Errorf("Expected no zones, got %v", zones)
+	}
+
+	var server Server
+
+	err = server.Decode(map[string]string{"image": "x", "commercial_type": "DEV1-S"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.Zone) != 0 {
+		t.Errorf("Expected no zone, got %s", server.Zone)
+	}
+}
+
+// TestZonesSpread tests balancing new servers over the zones
+func TestZonesSpread(t *testing.T) {
+	zones := Zones{scw.ZoneFrPar1, scw.ZoneFrPar2, scw.ZoneNlAms1}
+	servers := Servers{{Zone: scw.ZoneFrPar1}, {Zone: scw.ZoneFrPar1}, {Zone: scw.ZoneNlAms1}}
+
+	spread := zones.Spread(servers, 4)
+
+	expected := []scw.Zone{scw.ZoneFrPar2, scw.ZoneFrPar2, scw.ZoneNlAms1, scw.ZoneFrPar1}
+	for i := range expected {
+		if spread[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, spread)
+		}
+	}
+}
+
+// TestZonesTrim tests removing servers from the most over-represented zones first
+func TestZonesTrim(t *testing.T) {
+	zones := Zones{scw.ZoneFrPar1, scw.ZoneFrPar2, scw.ZoneNlAms1}
+	servers := Servers{{Zone: scw.ZoneFrPar1}, {Zone: scw.ZoneFrPar1}, {Zone: scw.ZoneFrPar1}, {Zone: scw.ZoneNlAms1}}
+
+	trim := zones.Trim(servers, 3)
+	if trim[scw.ZoneFrPar1] != 2 || trim[scw.ZoneNlAms1] != 1 || trim[scw.ZoneFrPar2] != 0 {
+		t.Errorf("Expected 2 from fr-par-1 and 1 from nl-ams-1, got %v", trim)
+	}
+
+	// Trimming more servers than available empties the pool
+	trim = zones.Trim(servers, 10)
+	if trim[scw.ZoneFrPar1] != 3 || trim[scw.ZoneNlAms1] != 1 {
+		t.Errorf("Expected all servers to be removed, got %v", trim)
+	}
+}
+
+// TestZonesTrimWithin tests moving the servers a zone cannot remove to the other zones
+func TestZonesTrimWithin(t *testing.T) {
+	zones := Zones{scw.ZoneFrPar1, scw.ZoneNlAms1}
+	servers := Servers{{Zone: scw.ZoneFrPar1}, {Zone: scw.ZoneFrPar1}, {Zone: scw.ZoneFrPar1}, {Zone: scw.ZoneNlAms1},
+		{Zone: scw.ZoneNlAms1}}
+	available := map[scw.Zone]int{scw.ZoneFrPar1: 1, scw.ZoneNlAms1: 2}
+
+	trim, short := zones.TrimWithin(servers, available, 2)
+	if trim[scw.ZoneFrPar1] != 1 || trim[scw.ZoneNlAms1] != 1 || short != 0 {
+		t.Errorf("Expected 1 from each zone, got %v and %d short", trim, short)
+	}
+
+	trim, short = zones.TrimWithin(servers, available, 5)
+	if trim[scw.ZoneFrPar1] != 1 || trim[scw.ZoneNlAms1] != 2 || short != 2 {
+		t.Errorf("Expected all available servers to be removed and 2 short, got %v and %d short", trim, short)
+	}
+}
@@ -0,0 +1,57 @@
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestLimiter tests that the limiter allows bursts and then refills at the configured rate
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := NewLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("Expected request %d of the burst to be allowed, got a delay of %s", i, d)
+		}
+	}
+
+	if d := l.reserve(); d != time.Millisecond*500 {
+		t.Errorf("Expected a delay of 500ms, got %s", d)
+	}
+
+	now = now.Add(time.Millisecond * 500)
+
+	if d := l.reserve(); d != 0 {
+		t.Errorf("Expected a refilled token, got a delay of %s", d)
+	}
+
+	l.Pause(now.Add(time.Second))
+
+	if d := l.reserve(); d != time.Second {
+		t.Errorf("Expected a paused delay of 1s, got %s", d)
+	}
+}
+
+// TestLimiterWait tests that waiting stops when the context is cancelled
+func TestLimiterWait(t *testing.T) {
+	l := NewLimiter(0, 0)
+
+	err := l.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Expected an unlimited limiter not to block, got %v", err)
+	}
+
+	l.Pause(time.Now().Add(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	err = l.Wait(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected a deadline exceeded error, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A set of default retry and rate limit settings
+const (
+	DefaultMaxRetries     = 4
+	DefaultMinBackoff     = time.Millisecond * 500
+	DefaultMaxBackoff     = time.Second * 30
+	DefaultRateLimit      = 10
+	DefaultRateBurst      = 10
+	DefaultAttemptTimeout = time.Second * 30
+)
+
+// Config represents the retry and rate limit settings of a transport
+type Config struct {
+	MaxRetries int           `mapstructure:"max_retries"`
+	MinBackoff time.Duration `mapstructure:"retry_min_backoff"`
+	MaxBackoff time.Duration `mapstructure:"retry_max_backoff"`
+	RateLimit  float64       `mapstructure:"rate_limit"`
+	RateBurst  int           `mapstructure:"rate_burst"`
+
+	// AttemptTimeout bounds every single attempt of a request, zero disables it
+	AttemptTimeout time.Duration `mapstructure:"attempt_timeout"`
+}
+
+// DefaultConfig returns the default retry and rate limit settings
+func DefaultConfig() Config {
+	return Config{
+		MaxRetries:     DefaultMaxRetries,
+		MinBackoff:     DefaultMinBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		RateLimit:      DefaultRateLimit,
+		RateBurst:      DefaultRateBurst,
+		AttemptTimeout: DefaultAttemptTimeout,
+	}
+}
+
+// Transport represents an HTTP transport that rate limits requests and retries idempotent requests
+// that failed with a transient error
+type Transport struct {
+	Base    http.RoundTripper
+	Config  Config
+	Limiter *Limiter
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewTransport returns a new transport wrapping `base` with the given settings, the base can be nil
+func NewTransport(base http.RoundTripper, config Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport).Clone()
+	}
+
+	return &Transport{
+		Base:    base,
+		Config:  config,
+		Limiter: NewLimiter(config.RateLimit, config.RateBurst),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Client returns a new HTTP client using the transport, attempts are bound by the transport instead of the client
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip satisfies the http.RoundTripper interface
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		err := t.Limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.attempt(req, attempt)
+
+		retry := attempt < t.Config.MaxRetries && Idempotent(req) && Retryable(resp, err) && ctx.Err() == nil
+		if resp != nil {
+			t.pause(resp)
+		}
+
+		if !retry {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if after, ok := RetryAfter(resp, time.Now()); ok && after > delay {
+				delay = after
+			}
+
+			// The response is discarded, drain it so that the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt performs a single attempt of the request
+func (t *Transport) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	if attempt > 0 && req.Body != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+
+	if t.Config.AttemptTimeout <= 0 {
+		return t.Base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.Config.AttemptTimeout)
+
+	resp, err := t.Base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The attempt context has to outlive the response body
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// pause pauses the limiter if the response reports that the rate limit was reached
+func (t *Transport) pause(resp *http.Response) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if after, ok := RetryAfter(resp, time.Now()); ok {
+			t.Limiter.Pause(time.Now().Add(after))
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			t.Limiter.Pause(time.Unix(reset, 0))
+		}
+	}
+}
+
+// backoff returns the exponential backoff of the given attempt with jitter, between half and the full backoff
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := t.Config.MinBackoff
+	for i := 0; i < attempt && d < t.Config.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > t.Config.MaxBackoff {
+		d = t.Config.MaxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return d/2 + time.Duration(t.rand.Int63n(int64(d/2)+1))
+}
+
+// Idempotent returns whether the request can safely be sent more than once
+func Idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.GetBody != nil
+	}
+
+	return false
+}
+
+// Retryable returns whether the outcome of an attempt is a transient error, i.e. a network error,
+// a rate limited request or an unavailable server
+func Retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// RetryAfter returns the delay of the `Retry-After` header, in seconds or as an HTTP date
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if len(header) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(header, 10, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// cancelBody represents a response body that cancels the context of its attempt once closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close satisfies the io.Closer interface
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,234 @@
+package retry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// NewTestServer returns a new server that responds with the given statuses in order and 200 afterwards
+func NewTestServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int32) {
+	var n int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&n, 1)) - 1
+		if i < len(statuses) {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+
+			w.WriteHeader(statuses[i])
+		}
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server, &n
+}
+
+// NewTestTransport returns a new transport with short backoffs and no rate limit
+func NewTestTransport() *Transport {
+	return NewTransport(nil, Config{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond * 10})
+}
+
+// TestTransportRetry tests that idempotent requests are retried on transient errors
+func TestTransportRetry(t *testing.T) {
+	server, n := NewTestServer(t, nil, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	resp, err := NewTestTransport().Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	if *n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", *n)
+	}
+}
+
+// TestTransportMaxRetries tests that the last response is returned once the retries are exhausted
+func TestTransportMaxRetries(t *testing.T) {
+	server, n := NewTestServer(t, nil, 502, 502, 502, 502, 502)
+
+	resp, err := NewTestTransport().Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", resp.StatusCode)
+	}
+
+	if *n != 4 {
+		t.Errorf("Expected 4 attempts, got %d", *n)
+	}
+}
+
+// TestTransportNonIdempotent tests that non-idempotent requests and permanent errors are not retried
+func TestTransportNonIdempotent(t *testing.T) {
+	server, n := NewTestServer(t, nil, http.StatusServiceUnavailable, http.StatusBadRequest)
+	client := NewTestTransport().Client()
+
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable || *n != 1 {
+		t.Errorf("Expected a single failed POST attempt, got status %d after %d attempts", resp.StatusCode, *n)
+	}
+
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest || *n != 2 {
+		t.Errorf("Expected a single failed GET attempt, got status %d after %d attempts in total", resp.StatusCode, *n)
+	}
+}
+
+// TestTransportBody tests that request bodies are sent again on retries
+func TestTransportBody(t *testing.T) {
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 16)
+		n, _ := r.Body.Read(b)
+		bodies = append(bodies, string(b[:n]))
+
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := NewTestTransport().Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if len(bodies) != 2 || bodies[0] != "hello" || bodies[1] != "hello" {
+		t.Errorf("Expected the body to be sent twice, got %q", bodies)
+	}
+}
+
+// TestTransportRetryAfter tests that the Retry-After header delays the retry and pauses the limiter
+func TestTransportRetryAfter(t *testing.T) {
+	server, _ := NewTestServer(t, http.Header{"Retry-After": []string{"1"}}, http.StatusTooManyRequests)
+
+	transport := NewTestTransport()
+
+	start := time.Now()
+
+	resp, err := transport.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("Expected the retry to wait for at least 1s, waited %s", d)
+	}
+
+	if transport.Limiter.paused.IsZero() {
+		t.Error("Expected the limiter to be paused")
+	}
+}
+
+// TestTransportCancel tests that backoffs stop when the context is cancelled
+func TestTransportCancel(t *testing.T) {
+	server, n := NewTestServer(t, nil, 503, 503, 503, 503)
+
+	transport := NewTransport(nil, Config{MaxRetries: 3, MinBackoff: time.Hour, MaxBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = transport.Client().Do(req)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if *n != 1 {
+		t.Errorf("Expected 1 attempt, got %d", *n)
+	}
+}
+
+// TestRetryAfter tests parsing the Retry-After header
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"5":                             time.Second * 5,
+		"Mon, 01 Jan 2024 00:00:10 GMT": time.Second * 10,
+		"Sun, 31 Dec 2023 00:00:00 GMT": 0,
+	}
+
+	for header, expected := range tests {
+		d, ok := RetryAfter(&http.Response{Header: http.Header{"Retry-After": []string{header}}}, now)
+		if !ok || d != expected {
+			t.Errorf("Expected %s for %q, got %s", expected, header, d)
+		}
+	}
+
+	if _, ok := RetryAfter(&http.Response{Header: http.Header{"Retry-After": []string{"soon"}}}, now); ok {
+		t.Error("Expected an invalid header to be ignored")
+	}
+}
+
+// TestTransportAttemptTimeout tests that attempts exceeding the attempt timeout are cancelled and retried
+func TestTransportAttemptTimeout(t *testing.T) {
+	var n int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt hangs until it is cancelled
+		if atomic.AddInt32(&n, 1) == 1 {
+			<-r.Context().Done()
+		}
+	}))
+
+	t.Cleanup(server.Close)
+
+	transport := NewTestTransport()
+	transport.Config.AttemptTimeout = time.Millisecond * 50
+
+	resp, err := transport.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if n := atomic.LoadInt32(&n); n != 2 {
+		t.Errorf("Expected the hanging attempt to be retried, got %d attempts", n)
+	}
+}